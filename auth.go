@@ -0,0 +1,191 @@
+package wire
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/erkl/heat"
+)
+
+// BearerAuthMiddleware returns a Middleware which adds an
+// "Authorization: Bearer <token>" header to requests which don't already
+// have an Authorization header. The token function is called for every such
+// request, allowing tokens to be rotated; if it returns an error, the
+// round-trip is aborted.
+func BearerAuthMiddleware(token func() (string, error)) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if !req.Fields.Has("Authorization") {
+			tok, err := token()
+			if err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+
+			req.Fields.Set("Authorization", "Bearer "+tok)
+		}
+
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// BasicAuthMiddleware returns a Middleware which adds an
+// "Authorization: Basic <credentials>" header, built from username and
+// password, to requests which don't already have an Authorization header.
+func BasicAuthMiddleware(username, password string) Middleware {
+	auth := basicAuth(username, password)
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if !req.Fields.Has("Authorization") {
+			req.Fields.Set("Authorization", auth)
+		}
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// BasicAuthFromNetrcMiddleware is like BasicAuthMiddleware, except the
+// credentials for each request are looked up by remote host in the .netrc
+// file at path. If path is empty, the file named by the NETRC environment
+// variable, or else ~/.netrc, is used.
+//
+// The file is read the first time it's needed; if that fails, all round-trips
+// fail with the same error. Requests for hosts without a matching entry (or
+// default entry) are passed on as-is.
+func BasicAuthFromNetrcMiddleware(path string) Middleware {
+	var once sync.Once
+	var entries []netrcEntry
+	var err error
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if !req.Fields.Has("Authorization") {
+			once.Do(func() {
+				entries, err = readNetrc(path)
+			})
+
+			if err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+
+			if e, ok := lookupNetrc(entries, stripPort(req.Remote)); ok {
+				req.Fields.Set("Authorization", basicAuth(e.login, e.password))
+			}
+		}
+
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// A netrcEntry is a single machine (or default) entry in a .netrc file. The
+// default entry has an empty machine name.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// readNetrc parses the .netrc file at path (see
+// BasicAuthFromNetrcMiddleware for defaults).
+func readNetrc(path string) ([]netrcEntry, error) {
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []netrcEntry
+	var cur *netrcEntry
+	var macro bool
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+
+		// Macro definitions run until the next blank line.
+		if macro {
+			macro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			// Grab the token's argument, if it has one.
+			var arg string
+			if i+1 < len(fields) {
+				arg = fields[i+1]
+			}
+
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: arg})
+				cur = &entries[len(entries)-1]
+				i++
+			case "default":
+				entries = append(entries, netrcEntry{})
+				cur = &entries[len(entries)-1]
+			case "login":
+				if cur != nil {
+					cur.login = arg
+				}
+				i++
+			case "password":
+				if cur != nil {
+					cur.password = arg
+				}
+				i++
+			case "account":
+				i++
+			case "macdef":
+				macro = true
+				i = len(fields)
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// lookupNetrc returns the first entry for host, or the default entry if
+// there is none.
+func lookupNetrc(entries []netrcEntry, host string) (netrcEntry, bool) {
+	for _, e := range entries {
+		if e.machine != "" && strings.EqualFold(e.machine, host) {
+			return e, true
+		}
+	}
+
+	for _, e := range entries {
+		if e.machine == "" {
+			return e, true
+		}
+	}
+
+	return netrcEntry{}, false
+}
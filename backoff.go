@@ -0,0 +1,65 @@
+package wire
+
+import (
+	"math/rand"
+	"time"
+)
+
+// A BackoffPolicy decides how long to wait between attempts at an operation,
+// such as retried round-trips (see RetryPolicy).
+type BackoffPolicy interface {
+	// Wait returns how long to wait before making the given attempt,
+	// counting from 1 for the first retry.
+	Wait(attempt int) time.Duration
+}
+
+// The BackoffFunc type is an adapter to allow the use of ordinary functions
+// as backoff policies.
+type BackoffFunc func(attempt int) time.Duration
+
+// Wait returns fn(attempt).
+func (fn BackoffFunc) Wait(attempt int) time.Duration {
+	return fn(attempt)
+}
+
+// ConstantBackoff returns a BackoffPolicy which always waits for d.
+func ConstantBackoff(d time.Duration) BackoffPolicy {
+	return BackoffFunc(func(int) time.Duration {
+		return d
+	})
+}
+
+// ExponentialBackoff returns a BackoffPolicy which waits for base before the
+// first retry, doubling the wait for each subsequent attempt, up to max. If
+// max is zero, waits aren't capped.
+//
+// If jitter is true, each wait is instead chosen at random between zero and
+// the value described above, which keeps clients that failed at the same time
+// from retrying in lockstep.
+func ExponentialBackoff(base, max time.Duration, jitter bool) BackoffPolicy {
+	return BackoffFunc(func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && (max <= 0 || d < max); i++ {
+			// Stop doubling before overflowing.
+			if d > (1<<63-1)/2 {
+				break
+			}
+			d *= 2
+		}
+
+		if max > 0 && d > max {
+			d = max
+		}
+
+		if jitter && d > 0 {
+			d = time.Duration(rand.Int63n(int64(d) + 1))
+		}
+
+		return d
+	})
+}
+
+// NoBackoff returns a BackoffPolicy which never waits.
+func NoBackoff() BackoffPolicy {
+	return ConstantBackoff(0)
+}
@@ -0,0 +1,255 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+var ErrNoBackends = errors.New("no backend available")
+
+// An LBPolicy picks the backend (a "host:port" address) which should receive
+// a request. Returning an empty string fails the round-trip with
+// ErrNoBackends.
+type LBPolicy interface {
+	Next(req *heat.Request) string
+}
+
+// Built-in policies are told which backends they're choosing between by
+// NewLoadBalancingTransport.
+type lbBinder interface {
+	bind(backends []string)
+}
+
+// Policies which need to know when a round-trip has finished.
+type lbReleaser interface {
+	release(backend string)
+}
+
+// NewLoadBalancingTransport returns a RoundTripper which distributes requests
+// across backends according to policy, by replacing each request's remote
+// address with the chosen backend before passing it on to inner. The Host
+// header field is left as-is.
+//
+// The built-in policies (RoundRobin, Random, LeastConnections and IPHash)
+// choose between backends. Custom policies may ignore them altogether.
+func NewLoadBalancingTransport(backends []string, policy LBPolicy, inner *Transport) RoundTripper {
+	if b, ok := policy.(lbBinder); ok {
+		b.bind(append([]string(nil), backends...))
+	}
+
+	rel, _ := policy.(lbReleaser)
+
+	return RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		backend := policy.Next(req)
+		if backend == "" {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, ErrNoBackends
+		}
+
+		req.Remote = backend
+
+		resp, err := inner.RoundTrip(ctx, req)
+		if rel == nil {
+			return resp, err
+		}
+
+		// Let the policy know once we're done with the backend.
+		if err != nil || resp.Body == nil {
+			rel.release(backend)
+		} else {
+			resp.Body = &releaseBody{r: resp.Body, fn: func() { rel.release(backend) }}
+		}
+
+		return resp, err
+	})
+}
+
+// RoundRobin returns an LBPolicy which cycles through the backends in order.
+func RoundRobin() LBPolicy {
+	return new(roundRobin)
+}
+
+type roundRobin struct {
+	backends []string
+	n        uint64
+}
+
+func (p *roundRobin) bind(backends []string) {
+	p.backends = backends
+}
+
+func (p *roundRobin) Next(req *heat.Request) string {
+	if len(p.backends) == 0 {
+		return ""
+	}
+	n := atomic.AddUint64(&p.n, 1) - 1
+	return p.backends[n%uint64(len(p.backends))]
+}
+
+// Random returns an LBPolicy which picks a backend at random.
+func Random() LBPolicy {
+	return new(random)
+}
+
+type random struct {
+	backends []string
+}
+
+func (p *random) bind(backends []string) {
+	p.backends = backends
+}
+
+func (p *random) Next(req *heat.Request) string {
+	if len(p.backends) == 0 {
+		return ""
+	}
+	return p.backends[rand.Intn(len(p.backends))]
+}
+
+// LeastConnections returns an LBPolicy which picks the backend with the
+// fewest requests in flight. A request counts as in flight until its
+// response body has been read in its entirety or closed.
+func LeastConnections() LBPolicy {
+	return new(leastConns)
+}
+
+type leastConns struct {
+	backends []string
+	active   []int64
+}
+
+func (p *leastConns) bind(backends []string) {
+	p.backends = backends
+	p.active = make([]int64, len(backends))
+}
+
+func (p *leastConns) Next(req *heat.Request) string {
+	if len(p.backends) == 0 {
+		return ""
+	}
+
+	best := 0
+	for i := range p.active {
+		if atomic.LoadInt64(&p.active[i]) < atomic.LoadInt64(&p.active[best]) {
+			best = i
+		}
+	}
+
+	atomic.AddInt64(&p.active[best], 1)
+	return p.backends[best]
+}
+
+func (p *leastConns) release(backend string) {
+	for i, b := range p.backends {
+		if b == backend {
+			atomic.AddInt64(&p.active[i], -1)
+			return
+		}
+	}
+}
+
+// IPHash returns an LBPolicy which picks backends by hashing the address of
+// the client on whose behalf a request is being made, so that requests from
+// the same client consistently go to the same backend. The client address is
+// taken from the X-Forwarded-For or X-Real-IP header fields; requests without
+// either are hashed by their remote host instead.
+func IPHash() LBPolicy {
+	return new(ipHash)
+}
+
+type ipHash struct {
+	backends []string
+}
+
+func (p *ipHash) bind(backends []string) {
+	p.backends = backends
+}
+
+func (p *ipHash) Next(req *heat.Request) string {
+	if len(p.backends) == 0 {
+		return ""
+	}
+
+	h := fnv.New32a()
+	io.WriteString(h, clientAddr(req))
+	return p.backends[h.Sum32()%uint32(len(p.backends))]
+}
+
+// clientAddr returns the address of the client req is being made on behalf
+// of, as described by IPHash.
+func clientAddr(req *heat.Request) string {
+	if v, ok := req.Fields.Get("X-Forwarded-For"); ok {
+		if i := strings.IndexByte(v, ','); i >= 0 {
+			v = v[:i]
+		}
+		return strings.TrimSpace(v)
+	}
+	if v, ok := req.Fields.Get("X-Real-IP"); ok {
+		return strings.TrimSpace(v)
+	}
+	return req.Remote
+}
+
+// Compile-time type check.
+var _ BodyReader = new(releaseBody)
+
+// releaseBody calls fn once the response body has been read in its entirety
+// or closed, whichever happens first.
+type releaseBody struct {
+	r  io.ReadCloser
+	fn func()
+}
+
+func (b *releaseBody) Read(buf []byte) (int, error) {
+	n, err := b.r.Read(buf)
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releaseBody) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeBodyTo(w, b.r)
+	if err == nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releaseBody) SetReadDeadline(t time.Time) error {
+	if br, ok := b.r.(BodyReader); ok {
+		return br.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (b *releaseBody) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
+func (b *releaseBody) Peek(n int) ([]byte, error) {
+	return peekBody(b.r, n)
+}
+
+func (b *releaseBody) Close() error {
+	err := b.r.Close()
+	b.release()
+	return err
+}
+
+func (b *releaseBody) release() {
+	if b.fn != nil {
+		b.fn()
+		b.fn = nil
+	}
+}
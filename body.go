@@ -1,17 +1,48 @@
 package wire
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net"
 	"time"
+
+	"github.com/erkl/heat"
 )
 
 var ErrReadAfterClose = errors.New("read after close on response body")
 var ErrBodyTimeout = errors.New("response body timed out")
+var ErrPeekUnsupported = errors.New("underlying response body does not support peeking")
+var ErrPeekSize = errors.New("peek size is negative or exceeds MaxPeekSize")
+
+// MaxPeekSize is the largest number of bytes which can be peeked at in a
+// single BodyReader.Peek call.
+const MaxPeekSize = bufferSize
+
+// Draining the remainder of a response body on Close (see
+// Transport.MaxDrainBytes) gives up after this long, in which case the
+// connection is closed instead of being reused.
+const maxDrainTime = 100 * time.Millisecond
+
+// BodyTimeoutError is returned by response body Read calls which time out. It
+// wraps the underlying net.Error, and matches ErrBodyTimeout when used with
+// errors.Is.
+type BodyTimeoutError struct {
+	Err net.Error
+}
+
+func (e *BodyTimeoutError) Error() string   { return ErrBodyTimeout.Error() + ": " + e.Err.Error() }
+func (e *BodyTimeoutError) Timeout() bool   { return true }
+func (e *BodyTimeoutError) Temporary() bool { return true }
+func (e *BodyTimeoutError) Unwrap() error   { return e.Err }
+
+func (e *BodyTimeoutError) Is(target error) bool {
+	return target == ErrBodyTimeout
+}
 
 // The BodyReader interface extends io.ReadClosers with the ability to set a deadline
-// for read operations.
+// for read operations, and to peek at upcoming bytes.
 //
 // All non-nil response bodies returned by Transport.RoundTrip implement this
 // interface.
@@ -21,11 +52,31 @@ type BodyReader interface {
 	// SetReadDeadline sets the deadline for future Read calls. A zero value
 	// for t clears any previous deadline.
 	SetReadDeadline(t time.Time) error
+
+	// SetReadTimeout is like SetReadDeadline, but sets the deadline relative
+	// to the current time. A zero value for d clears any previous deadline.
+	SetReadTimeout(d time.Duration) error
+
+	// Peek returns the next n bytes of the body without consuming them.
+	// If fewer than n bytes are returned, the error explains why (io.EOF
+	// if the body ended). The returned slice is only valid until the next
+	// call to Read or Peek. Peek fails with ErrPeekSize if n is negative
+	// or larger than MaxPeekSize.
+	Peek(n int) ([]byte, error)
 }
 
 // Compile-time type check.
 var _ BodyReader = new(body)
 
+// deadline converts a relative timeout into an absolute deadline. A zero
+// timeout yields a zero deadline.
+func deadline(d time.Duration) time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
 type body struct {
 	// Actual body io.Reader.
 	r io.Reader
@@ -36,6 +87,9 @@ type body struct {
 	// Persisted error.
 	err error
 
+	// Bytes which have been peeked at, but not yet read.
+	peeked peekBuffer
+
 	// Has the user closed the body?
 	closed bool
 
@@ -45,23 +99,89 @@ type body struct {
 }
 
 func (b *body) Read(buf []byte) (int, error) {
+	if len(b.peeked) > 0 {
+		return b.peeked.read(buf), nil
+	}
 	if b.err != nil {
 		return 0, b.err
 	}
 
 	n, err := b.r.Read(buf)
 	if err != nil {
-		// Don't persist timeout errors.
-		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
-			err = ErrBodyTimeout
-		} else {
-			b.err = err
-		}
+		err = b.fail(err)
 	}
 
 	return n, err
 }
 
+// WriteTo implements io.WriterTo, letting io.Copy hand the body straight to
+// the underlying reader's WriteTo method (when it has one).
+func (b *body) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+
+	if len(b.peeked) > 0 {
+		n, err := w.Write(b.peeked)
+		b.peeked = b.peeked[n:]
+		written = int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	if b.err != nil {
+		if b.err == io.EOF {
+			return written, nil
+		}
+		return written, b.err
+	}
+
+	wt, ok := b.r.(io.WriterTo)
+	if !ok {
+		// Hide our own WriteTo method from io.Copy.
+		n, err := io.Copy(w, struct{ io.Reader }{b})
+		return written + n, err
+	}
+
+	n, err := wt.WriteTo(w)
+	if err != nil {
+		return written + n, b.fail(err)
+	}
+
+	b.err = io.EOF
+	return written + n, nil
+}
+
+func (b *body) Peek(n int) ([]byte, error) {
+	if err := checkPeekSize(n); err != nil {
+		return nil, err
+	}
+	if len(b.peeked) >= n {
+		return b.peeked[:n], nil
+	}
+	if b.err != nil {
+		return b.peeked, b.err
+	}
+
+	p, err := b.peeked.fill(b.r, n)
+	if err != nil {
+		err = b.fail(err)
+	}
+
+	return p, err
+}
+
+// fail persists err (unless it's a timeout error, in which case it's wrapped
+// in a BodyTimeoutError) and returns it.
+func (b *body) fail(err error) error {
+	// Don't persist timeout errors.
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return &BodyTimeoutError{nerr}
+	}
+
+	b.err = err
+	return err
+}
+
 func (b *body) SetReadDeadline(t time.Time) error {
 	// Don't bother setting a timeout unless Read actually has a chance to
 	// succeed. This also prevents the user from setting a deadline on a
@@ -73,7 +193,22 @@ func (b *body) SetReadDeadline(t time.Time) error {
 	return b.c.raw.SetReadDeadline(t)
 }
 
+func (b *body) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
 func (b *body) Close() error {
+	// Drain small remainders, so the connection can be reused.
+	if b.err == nil && b.reuse && !b.closed {
+		if max := b.c.t.MaxDrainBytes; max > 0 {
+			b.c.raw.SetReadDeadline(time.Now().Add(maxDrainTime))
+			if _, err := io.CopyN(ioutil.Discard, b.r, max+1); err == io.EOF {
+				b.err = io.EOF
+			}
+			b.c.raw.SetReadDeadline(time.Time{})
+		}
+	}
+
 	if b.err == nil {
 		b.err = ErrReadAfterClose
 	}
@@ -86,3 +221,109 @@ func (b *body) Close() error {
 	b.closed = true
 	return nil
 }
+
+// Compile-time type check.
+var _ BodyReader = new(bytesBody)
+
+// A bytesBody is a BodyReader backed by an in-memory buffer, used for
+// response bodies which have been read ahead of time.
+type bytesBody struct {
+	*bytes.Reader
+}
+
+func newBytesBody(data []byte) *bytesBody {
+	return &bytesBody{bytes.NewReader(data)}
+}
+
+func (b *bytesBody) SetReadDeadline(t time.Time) error    { return nil }
+func (b *bytesBody) SetReadTimeout(d time.Duration) error { return nil }
+func (b *bytesBody) Close() error                         { return nil }
+
+func (b *bytesBody) Peek(n int) ([]byte, error) {
+	if err := checkPeekSize(n); err != nil {
+		return nil, err
+	}
+
+	p := make([]byte, n)
+	m, err := b.ReadAt(p, b.Size()-int64(b.Len()))
+	return p[:m], err
+}
+
+// withBody returns a shallow copy of resp (with its own copy of the header
+// fields), with data as its body.
+func withBody(resp *heat.Response, data []byte) *heat.Response {
+	dup := *resp
+	dup.Fields = append(heat.Fields(nil), resp.Fields...)
+
+	if data != nil {
+		dup.Body = newBytesBody(data)
+	} else {
+		dup.Body = nil
+	}
+
+	return &dup
+}
+
+// A peekBuffer holds bytes which have been peeked at, but not yet read.
+type peekBuffer []byte
+
+// fill reads from r until the buffer holds at least n bytes, and returns the
+// first n of them. If r fails first, everything buffered is returned along
+// with the error.
+func (p *peekBuffer) fill(r io.Reader, n int) ([]byte, error) {
+	if err := checkPeekSize(n); err != nil {
+		return nil, err
+	}
+
+	for len(*p) < n {
+		if cap(*p) < n {
+			buf := make([]byte, len(*p), n)
+			copy(buf, *p)
+			*p = buf
+		}
+
+		m, err := r.Read((*p)[len(*p):n])
+		*p = (*p)[:len(*p)+m]
+
+		if err != nil {
+			return *p, err
+		}
+	}
+
+	return (*p)[:n], nil
+}
+
+// read moves as many buffered bytes as possible into buf.
+func (p *peekBuffer) read(buf []byte) int {
+	n := copy(buf, *p)
+	if *p = (*p)[n:]; len(*p) == 0 {
+		*p = nil
+	}
+	return n
+}
+
+// checkPeekSize verifies that n is a valid number of bytes to peek at.
+func checkPeekSize(n int) error {
+	if n < 0 || n > MaxPeekSize {
+		return ErrPeekSize
+	}
+	return nil
+}
+
+// peekBody calls r's Peek method, if r is a BodyReader.
+func peekBody(r io.Reader, n int) ([]byte, error) {
+	if br, ok := r.(BodyReader); ok {
+		return br.Peek(n)
+	}
+	return nil, ErrPeekUnsupported
+}
+
+// writeBodyTo copies r to w, using r's WriteTo method if it has one. Body
+// wrappers use it to implement io.WriterTo themselves, so that wrapping a
+// body doesn't hide its WriteTo method from io.Copy.
+func writeBodyTo(w io.Writer, r io.Reader) (int64, error) {
+	if wt, ok := r.(io.WriterTo); ok {
+		return wt.WriteTo(w)
+	}
+	return io.Copy(w, r)
+}
@@ -0,0 +1,26 @@
+package wire
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPeekSize(t *testing.T) {
+	bodies := map[string]BodyReader{
+		"bytesBody":    newBytesBody([]byte("hello")),
+		"prefixedBody": &prefixedBody{peeked: []byte("he"), r: ioutil.NopCloser(strings.NewReader("llo"))},
+	}
+
+	for name, b := range bodies {
+		for _, n := range []int{-1, MaxPeekSize + 1, 1 << 30} {
+			if _, err := b.Peek(n); err != ErrPeekSize {
+				t.Errorf("%s.Peek(%d) returned %v, want %v", name, n, err, ErrPeekSize)
+			}
+		}
+
+		if p, err := b.Peek(3); err != nil || string(p) != "hel" {
+			t.Errorf("%s.Peek(3) returned (%q, %v)", name, p, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerConfig configures the behaviour of CircuitBreakerMiddleware.
+type CircuitBreakerConfig struct {
+	// Threshold is the number of consecutive failures required to open the
+	// circuit. If zero, a single failure is enough.
+	Threshold int
+
+	// Cooldown specifies how long the circuit stays open before a single
+	// probe request is let through to test the backend.
+	Cooldown time.Duration
+
+	// IsFailure reports whether a round-trip should count as a failure. If
+	// nil, round-trips are considered failed when they return an error, or
+	// when the server responds with a 5XX status code.
+	IsFailure func(resp *heat.Response, err error) bool
+}
+
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type breaker struct {
+	cfg CircuitBreakerConfig
+
+	// Mutex protecting the fields below.
+	mu sync.Mutex
+
+	// Current state of the circuit.
+	state int
+
+	// Number of consecutive failures seen while closed.
+	failures int
+
+	// When the circuit was last opened.
+	openedAt time.Time
+
+	// Incremented on every state change. Results of requests issued in an
+	// earlier generation are ignored, so that requests which were already
+	// in flight when the circuit opened can't close it (or keep it open).
+	gen uint64
+}
+
+// CircuitBreakerMiddleware returns a Middleware which stops issuing requests
+// after a number of consecutive failures. While the circuit is open, all
+// round-trips fail immediately with ErrCircuitOpen. Once cfg.Cooldown has
+// passed, a single probe request is allowed through; if it succeeds the
+// circuit is closed again, otherwise it is re-opened.
+func CircuitBreakerMiddleware(cfg CircuitBreakerConfig) Middleware {
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = defaultIsFailure
+	}
+
+	b := &breaker{cfg: cfg}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		gen, ok := b.allow()
+		if !ok {
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := next.RoundTrip(ctx, req)
+		b.record(gen, cfg.IsFailure(resp, err))
+
+		return resp, err
+	}
+}
+
+// allow reports whether a request may be issued, and if so, the generation it
+// belongs to. When the cooldown period has passed, only the first caller is
+// allowed through as a probe.
+func (b *breaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitClosed:
+		return b.gen, true
+
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return 0, false
+		}
+		b.setState(circuitHalfOpen)
+		return b.gen, true
+
+	default:
+		// A probe is already in flight.
+		return 0, false
+	}
+}
+
+// record records the result of a request issued in generation gen.
+func (b *breaker) record(gen uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if gen != b.gen {
+		return
+	}
+
+	if !failed {
+		if b.state != circuitClosed {
+			b.setState(circuitClosed)
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+
+	if b.state == circuitHalfOpen || b.failures >= b.cfg.Threshold {
+		b.setState(circuitOpen)
+		b.openedAt = time.Now()
+	}
+}
+
+// setState moves the circuit to a new state, starting a new generation. The
+// caller must hold b.mu.
+func (b *breaker) setState(state int) {
+	b.state = state
+	b.gen++
+}
+
+func defaultIsFailure(resp *heat.Response, err error) bool {
+	return err != nil || resp.Status >= 500
+}
@@ -0,0 +1,47 @@
+package wire
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+func TestCircuitBreakerIgnoresStaleResults(t *testing.T) {
+	mw := CircuitBreakerMiddleware(CircuitBreakerConfig{
+		Threshold: 1,
+		Cooldown:  time.Hour,
+	})
+
+	// Hold a successful round-trip in flight while another one fails and
+	// opens the circuit.
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+
+	slow := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		close(started)
+		<-finish
+		return &heat.Response{Status: 200}, nil
+	})
+	failing := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		return &heat.Response{Status: 503}, nil
+	})
+
+	go func() {
+		mw(context.Background(), new(heat.Request), slow)
+		close(done)
+	}()
+	<-started
+
+	mw(context.Background(), new(heat.Request), failing)
+
+	close(finish)
+	<-done
+
+	// The stale success mustn't have closed the circuit.
+	if _, err := mw(context.Background(), new(heat.Request), failing); err != ErrCircuitOpen {
+		t.Fatalf("round-trip returned %v, want %v", err, ErrCircuitOpen)
+	}
+}
@@ -0,0 +1,269 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// A CacheStore stores responses for CacheMiddleware.
+type CacheStore interface {
+	// Get returns the response stored under key, if there is one and it
+	// hasn't expired. Each call must return a response (and body) which
+	// the caller is free to consume.
+	Get(key string) (*heat.Response, bool)
+
+	// Set stores resp under key for the duration of ttl. The response body
+	// (if any) is fully buffered, and should be read in its entirety.
+	Set(key string, resp *heat.Response, ttl time.Duration)
+}
+
+// A CachePolicy decides which responses may be cached, and for how long.
+type CachePolicy interface {
+	// TTL returns how long resp (the response to req) may be cached. A
+	// non-positive value means it must not be cached.
+	TTL(req *heat.Request, resp *heat.Response) time.Duration
+}
+
+// DefaultCachePolicy is a CachePolicy which caches successful responses to
+// GET and HEAD requests, honouring the Cache-Control header's "no-store",
+// "no-cache", "private" and "max-age" directives.
+type DefaultCachePolicy struct {
+	// TTL used for cacheable responses without a max-age directive. If
+	// zero, such responses aren't cached.
+	DefaultTTL time.Duration
+}
+
+func (p DefaultCachePolicy) TTL(req *heat.Request, resp *heat.Response) time.Duration {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return 0
+	}
+
+	switch resp.Status {
+	case 200, 203, 204, 300, 301, 404, 410:
+	default:
+		return 0
+	}
+
+	ttl := p.DefaultTTL
+
+	cc, _ := resp.Fields.Get("Cache-Control")
+	for _, directive := range strings.Split(cc, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+
+		switch {
+		case directive == "no-store", directive == "no-cache", directive == "private":
+			return 0
+
+		case strings.HasPrefix(directive, "max-age="):
+			secs, err := strconv.ParseInt(directive[len("max-age="):], 10, 64)
+			if err != nil {
+				return 0
+			}
+			ttl = time.Duration(secs) * time.Second
+		}
+	}
+
+	return ttl
+}
+
+// CacheMiddleware returns a Middleware which serves responses from store when
+// possible, and stores new responses according to policy. Requests with a
+// "Cache-Control: no-store" or "no-cache" header bypass the cache, as do
+// requests with an Authorization header.
+//
+// Responses are cached separately for each combination of the request header
+// fields listed in their Vary header. Responses with "Vary: *" aren't cached.
+//
+// Cacheable response bodies are read into memory in their entirety before
+// the round-trip returns. Responses with bodies longer than
+// DefaultMaxBodySize bytes aren't cached.
+func CacheMiddleware(store CacheStore, policy CachePolicy) Middleware {
+	// The Vary field names of the most recently cached response for each
+	// method and URL.
+	var mu sync.Mutex
+	var vary = make(map[string][]string)
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if cc, ok := req.Fields.Get("Cache-Control"); ok {
+			cc = strings.ToLower(cc)
+			if strings.Contains(cc, "no-store") || strings.Contains(cc, "no-cache") {
+				return next.RoundTrip(ctx, req)
+			}
+		}
+
+		// Responses to authorized requests are private.
+		if req.Fields.Has("Authorization") {
+			return next.RoundTrip(ctx, req)
+		}
+
+		base := req.Method + " " + req.Scheme + "://" + req.Remote + req.URI
+
+		mu.Lock()
+		names := vary[base]
+		mu.Unlock()
+
+		if resp, ok := store.Get(cacheKey(base, names, req)); ok {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return resp, nil
+		}
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl := policy.TTL(req, resp)
+		if ttl <= 0 {
+			return resp, nil
+		}
+
+		names, ok := varyFields(resp)
+		if !ok {
+			return resp, nil
+		}
+
+		// Buffer the response body.
+		var data []byte
+		if resp.Body != nil {
+			data, err = ioutil.ReadAll(io.LimitReader(resp.Body, DefaultMaxBodySize+1))
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+
+			if len(data) > DefaultMaxBodySize {
+				resp.Body = &prefixedBody{peeked: data, r: resp.Body}
+				return resp, nil
+			}
+
+			resp.Body.Close()
+		}
+
+		mu.Lock()
+		vary[base] = names
+		mu.Unlock()
+
+		store.Set(cacheKey(base, names, req), withBody(resp, data), ttl)
+		return withBody(resp, data), nil
+	}
+}
+
+// varyFields returns the (lower-case, sorted) names of the request header
+// fields listed in resp's Vary header. It returns false if the response varies
+// on something other than header fields.
+func varyFields(resp *heat.Response) ([]string, bool) {
+	var names []string
+
+	for _, f := range resp.Fields {
+		if !strings.EqualFold(f.Name, "Vary") {
+			continue
+		}
+
+		for _, name := range strings.Split(f.Value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			switch name {
+			case "":
+			case "*":
+				return nil, false
+			default:
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names, true
+}
+
+// cacheKey returns the key under which the response to req is cached, given
+// the base key and the names of the header fields it varies on.
+func cacheKey(base string, names []string, req *heat.Request) string {
+	if len(names) == 0 {
+		return base
+	}
+
+	var b strings.Builder
+	b.WriteString(base)
+
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(":")
+
+		var n int
+		for _, f := range req.Fields {
+			if strings.EqualFold(f.Name, name) {
+				if n++; n > 1 {
+					b.WriteString(",")
+				}
+				b.WriteString(strconv.Quote(f.Value))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+type cacheEntry struct {
+	resp    *heat.Response
+	data    []byte
+	expires time.Time
+}
+
+// MemoryCacheStore is a CacheStore which keeps responses in memory. Expired
+// entries are removed lazily, when they are next looked up.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewMemoryCacheStore returns a new, empty MemoryCacheStore.
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*heat.Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(e.expires) {
+		delete(s.entries, key)
+		return nil, false
+	}
+
+	return withBody(e.resp, e.data), true
+}
+
+func (s *MemoryCacheStore) Set(key string, resp *heat.Response, ttl time.Duration) {
+	var data []byte
+	if resp.Body != nil {
+		data, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = cacheEntry{
+		resp:    withBody(resp, nil),
+		data:    data,
+		expires: time.Now().Add(ttl),
+	}
+}
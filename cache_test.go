@@ -0,0 +1,93 @@
+package wire
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+func TestCacheVary(t *testing.T) {
+	mw := CacheMiddleware(NewMemoryCacheStore(), DefaultCachePolicy{DefaultTTL: time.Hour})
+
+	var calls int
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		calls++
+		lang, _ := req.Fields.Get("Accept-Language")
+		resp := &heat.Response{Status: 200}
+		resp.Fields.Set("Vary", "Accept-Language")
+		return withBody(resp, []byte(lang)), nil
+	})
+
+	get := func(lang string) string {
+		req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+		req.Fields.Set("Accept-Language", lang)
+
+		resp, err := mw(context.Background(), req, next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	for _, lang := range []string{"en", "sv", "en", "sv"} {
+		if got := get(lang); got != lang {
+			t.Errorf("got %q for Accept-Language %q", got, lang)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("made %d round-trips, want 2", calls)
+	}
+}
+
+func TestCacheAuthorization(t *testing.T) {
+	mw := CacheMiddleware(NewMemoryCacheStore(), DefaultCachePolicy{DefaultTTL: time.Hour})
+
+	var calls int
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		calls++
+		return withBody(&heat.Response{Status: 200}, []byte("secret")), nil
+	})
+
+	for i := 0; i < 2; i++ {
+		req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+		req.Fields.Set("Authorization", "Bearer token")
+		if _, err := mw(context.Background(), req, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("made %d round-trips, want 2", calls)
+	}
+}
+
+func TestCacheOversizedBody(t *testing.T) {
+	mw := CacheMiddleware(NewMemoryCacheStore(), DefaultCachePolicy{DefaultTTL: time.Hour})
+
+	var calls int
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		calls++
+		return withBody(&heat.Response{Status: 200}, make([]byte, DefaultMaxBodySize+1)), nil
+	})
+
+	for i := 0; i < 2; i++ {
+		req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+		resp, err := mw(context.Background(), req, next)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil || len(data) != DefaultMaxBodySize+1 {
+			t.Fatalf("read %d bytes (err = %v), want %d", len(data), err, DefaultMaxBodySize+1)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("made %d round-trips, want 2", calls)
+	}
+}
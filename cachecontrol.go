@@ -0,0 +1,152 @@
+package wire
+
+import (
+	"context"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+// A CacheControlPolicy configures CacheControlMiddleware.
+type CacheControlPolicy struct {
+	// RequestDirectives are added to the Cache-Control header field of
+	// outgoing requests (for example "no-cache" or "max-age=60"), unless
+	// the request already carries a directive of the same name.
+	RequestDirectives []string
+
+	// RequireMaxAge requires responses to carry a "max-age" or "s-maxage"
+	// directive.
+	RequireMaxAge bool
+
+	// ForbiddenDirectives lists directives responses may not carry (for
+	// example "no-store").
+	ForbiddenDirectives []string
+
+	// OnViolation, if set, is called for responses which violate the
+	// policy, which are then returned as usual. If nil, such round-trips
+	// fail with a *CacheControlError instead.
+	OnViolation func(req *heat.Request, err *CacheControlError)
+}
+
+// A CacheControlError describes a response which violates a
+// CacheControlPolicy.
+type CacheControlError struct {
+	// Directive is the missing or forbidden directive.
+	Directive string
+	Missing   bool
+
+	// Resp is the offending response. When returned by the round-trip,
+	// its body has already been closed.
+	Resp *heat.Response
+}
+
+func (e *CacheControlError) Error() string {
+	if e.Missing {
+		return "response lacks required Cache-Control directive " + e.Directive
+	}
+	return "response carries forbidden Cache-Control directive " + e.Directive
+}
+
+// CacheControlMiddleware returns a Middleware which adds Cache-Control
+// directives to requests, and checks the Cache-Control directives of
+// responses, according to policy.
+func CacheControlMiddleware(policy CacheControlPolicy) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if len(policy.RequestDirectives) > 0 {
+			addDirectives(&req.Fields, policy.RequestDirectives)
+		}
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		v, _ := resp.Fields.Get("Cache-Control")
+		e := policy.check(parseCacheControl(v))
+		if e == nil {
+			return resp, nil
+		}
+
+		e.Resp = resp
+
+		if policy.OnViolation != nil {
+			policy.OnViolation(req, e)
+			return resp, nil
+		}
+
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+
+		return nil, e
+	}
+}
+
+// check returns an error describing the first way in which the response
+// directives violate the policy, if any.
+func (p *CacheControlPolicy) check(directives map[string]string) *CacheControlError {
+	if p.RequireMaxAge {
+		_, maxAge := directives["max-age"]
+		_, sMaxAge := directives["s-maxage"]
+		if !maxAge && !sMaxAge {
+			return &CacheControlError{Directive: "max-age", Missing: true}
+		}
+	}
+
+	for _, d := range p.ForbiddenDirectives {
+		if _, ok := directives[strings.ToLower(d)]; ok {
+			return &CacheControlError{Directive: d}
+		}
+	}
+
+	return nil
+}
+
+// addDirectives adds directives to the Cache-Control header field in fields,
+// skipping those already present.
+func addDirectives(fields *heat.Fields, directives []string) {
+	v, _ := fields.Get("Cache-Control")
+	have := parseCacheControl(v)
+
+	for _, d := range directives {
+		name := d
+		if i := strings.IndexByte(d, '='); i >= 0 {
+			name = d[:i]
+		}
+
+		if _, ok := have[strings.ToLower(strings.TrimSpace(name))]; ok {
+			continue
+		}
+
+		if v != "" {
+			v += ", "
+		}
+		v += d
+	}
+
+	if v != "" {
+		fields.Set("Cache-Control", v)
+	}
+}
+
+// parseCacheControl parses a Cache-Control header field value into a map of
+// lower-case directive names to their (unquoted) arguments.
+func parseCacheControl(v string) map[string]string {
+	directives := make(map[string]string)
+
+	for _, d := range strings.Split(v, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+
+		var arg string
+		if i := strings.IndexByte(d, '='); i >= 0 {
+			d, arg = d[:i], strings.Trim(strings.TrimSpace(d[i+1:]), `"`)
+		}
+
+		directives[strings.ToLower(strings.TrimSpace(d))] = arg
+	}
+
+	return directives
+}
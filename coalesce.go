@@ -0,0 +1,156 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/erkl/heat"
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalesceMiddleware returns a Middleware which merges concurrent, identical
+// GET and HEAD requests (with the same method and URL) into a single
+// round-trip, the response to which is shared by all callers. Response
+// bodies are buffered in memory, up to DefaultMaxBodySize bytes.
+//
+// Header fields aren't considered when deciding whether two requests are
+// identical, so this shouldn't be used when responses depend on header
+// fields such as Authorization or Cookie. Requests with a body are never
+// coalesced. The round-trip is made using the context of the request which
+// started it, but every caller stops waiting for it when its own context is
+// done.
+func CoalesceMiddleware() Middleware {
+	return CoalesceLimitMiddleware(DefaultMaxBodySize)
+}
+
+// CoalesceLimitMiddleware is like CoalesceMiddleware, except response bodies
+// are buffered up to limit bytes. When a response body exceeds the limit,
+// the request which started the round-trip receives the response as usual,
+// but the other callers fail with ErrBodyTooLarge.
+func CoalesceLimitMiddleware(limit int64) Middleware {
+	var group singleflight.Group
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if req.Body != nil || (req.Method != "GET" && req.Method != "HEAD") {
+			return next.RoundTrip(ctx, req)
+		}
+
+		// Only the first caller's function is actually run, in which case
+		// an oversized response is handed back to it through own.
+		var own *heat.Response
+
+		key := req.Method + " " + req.Scheme + "://" + req.Remote + req.URI
+		ch := group.DoChan(key, func() (interface{}, error) {
+			resp, err := next.RoundTrip(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			if resp.Body == nil {
+				return coalesced{resp, nil}, nil
+			}
+
+			data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+
+			if int64(len(data)) > limit {
+				own = resp
+				own.Body = &prefixedBody{peeked: data, r: resp.Body}
+				return nil, ErrBodyTooLarge
+			}
+
+			resp.Body.Close()
+			return coalesced{resp, data}, nil
+		})
+
+		var res singleflight.Result
+
+		select {
+		case res = <-ch:
+		case <-ctx.Done():
+			// Don't leak an oversized response nobody will read.
+			go func() {
+				<-ch
+				if own != nil {
+					own.Body.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+
+		if own != nil {
+			return own, nil
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		// Give each caller its own copy of the response.
+		r := res.Val.(coalesced)
+		return withBody(r.resp, r.data), nil
+	}
+}
+
+// A shared response, with its buffered body.
+type coalesced struct {
+	resp *heat.Response
+	data []byte
+}
+
+// Compile-time type check.
+var _ BodyReader = new(prefixedBody)
+
+// prefixedBody is a response body some of which has already been read into
+// memory.
+type prefixedBody struct {
+	// Bytes read from r ahead of time.
+	peeked peekBuffer
+
+	// The rest of the body.
+	r io.ReadCloser
+}
+
+func (b *prefixedBody) Read(buf []byte) (int, error) {
+	if len(b.peeked) > 0 {
+		return b.peeked.read(buf), nil
+	}
+	return b.r.Read(buf)
+}
+
+func (b *prefixedBody) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	if len(b.peeked) > 0 {
+		m, err := w.Write(b.peeked)
+		b.peeked = b.peeked[m:]
+		if n = int64(m); err != nil {
+			return n, err
+		}
+		b.peeked = nil
+	}
+
+	m, err := writeBodyTo(w, b.r)
+	return n + m, err
+}
+
+func (b *prefixedBody) SetReadDeadline(t time.Time) error {
+	if br, ok := b.r.(BodyReader); ok {
+		return br.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (b *prefixedBody) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
+func (b *prefixedBody) Peek(n int) ([]byte, error) {
+	return b.peeked.fill(b.r, n)
+}
+
+func (b *prefixedBody) Close() error {
+	return b.r.Close()
+}
@@ -0,0 +1,76 @@
+package wire
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+func TestCoalesceOversizedBody(t *testing.T) {
+	mw := CoalesceLimitMiddleware(4)
+
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		return withBody(&heat.Response{Status: 200}, []byte("0123456789")), nil
+	})
+
+	req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+	resp, err := mw(context.Background(), req, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	br, ok := resp.Body.(BodyReader)
+	if !ok {
+		t.Fatalf("response body is a %T, not a BodyReader", resp.Body)
+	}
+
+	if p, err := br.Peek(7); err != nil || string(p) != "0123456" {
+		t.Fatalf("Peek returned (%q, %v)", p, err)
+	}
+
+	data, err := ioutil.ReadAll(br)
+	if err != nil || string(data) != "0123456789" {
+		t.Fatalf("read (%q, %v)", data, err)
+	}
+}
+
+func TestCoalesceWaiterCancel(t *testing.T) {
+	mw := CoalesceMiddleware()
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	defer close(finish)
+
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		close(started)
+		<-finish
+		return &heat.Response{Status: 200}, nil
+	})
+
+	req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+	go mw(context.Background(), req, next)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// The waiter must give up when its own context is done, even though
+	// the shared round-trip is still in flight.
+	errc := make(chan error, 1)
+	go func() {
+		_, err := mw(ctx, req, next)
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("round-trip returned %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter ignored its context")
+	}
+}
@@ -0,0 +1,181 @@
+package wire
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/erkl/heat"
+)
+
+// Supported content codings.
+var decoders = map[string]func(r io.Reader) (io.Reader, error){
+	"gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": func(r io.Reader) (io.Reader, error) {
+		return zlib.NewReader(r)
+	},
+	"br": func(r io.Reader) (io.Reader, error) {
+		return brotli.NewReader(r), nil
+	},
+}
+
+// CompressionConfig configures CompressionMiddleware.
+type CompressionConfig struct {
+	// Formats lists the content codings to request, in order of
+	// preference. Supported codings are "gzip", "deflate" and "br"; others
+	// are ignored. If empty, all supported codings are requested.
+	Formats []string
+}
+
+// CompressionMiddleware returns a Middleware which asks servers for
+// compressed responses, and transparently decompresses them. Decompressed
+// responses have their Content-Encoding and Content-Length headers removed.
+//
+// Requests which already carry an Accept-Encoding header are left alone, as
+// are their responses.
+func CompressionMiddleware(cfg CompressionConfig) Middleware {
+	formats := cfg.Formats
+	if len(formats) == 0 {
+		formats = []string{"gzip", "deflate", "br"}
+	}
+
+	var accept []string
+	for _, f := range formats {
+		if _, ok := decoders[f]; ok {
+			accept = append(accept, f)
+		}
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if len(accept) == 0 || req.Fields.Has("Accept-Encoding") {
+			return next.RoundTrip(ctx, req)
+		}
+
+		req.Fields.Set("Accept-Encoding", strings.Join(accept, ", "))
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Body == nil {
+			return resp, nil
+		}
+
+		enc, _ := resp.Fields.Get("Content-Encoding")
+		enc = strings.ToLower(strings.TrimSpace(enc))
+
+		for _, f := range accept {
+			if f == enc {
+				// The body's length and encoding no longer apply.
+				resp.Fields.Del("Content-Encoding")
+				resp.Fields.Del("Content-Length")
+
+				resp.Body = &decodedBody{r: resp.Body, open: decoders[f]}
+				break
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// Compile-time type check.
+var _ BodyReader = new(decodedBody)
+
+type decodedBody struct {
+	// Compressed response body.
+	r io.ReadCloser
+
+	// Decompressing reader, initialized using open on the first Read call
+	// (because some decoders block until they've read a header).
+	dec  io.Reader
+	open func(r io.Reader) (io.Reader, error)
+
+	// Persisted error.
+	err error
+
+	// Decompressed bytes which have been peeked at, but not yet read.
+	peeked peekBuffer
+}
+
+func (b *decodedBody) Read(buf []byte) (int, error) {
+	if len(b.peeked) > 0 {
+		return b.peeked.read(buf), nil
+	}
+	if err := b.init(); err != nil {
+		return 0, err
+	}
+
+	n, err := b.dec.Read(buf)
+	if err != nil && !errors.Is(err, ErrBodyTimeout) {
+		b.err = err
+	}
+
+	return n, err
+}
+
+func (b *decodedBody) Peek(n int) ([]byte, error) {
+	if err := checkPeekSize(n); err != nil {
+		return nil, err
+	}
+	if len(b.peeked) >= n {
+		return b.peeked[:n], nil
+	}
+	if err := b.init(); err != nil {
+		return b.peeked, err
+	}
+
+	p, err := b.peeked.fill(b.dec, n)
+	if err != nil && !errors.Is(err, ErrBodyTimeout) {
+		b.err = err
+	}
+
+	return p, err
+}
+
+// init returns the persisted error, if any, and otherwise makes sure the
+// decompressing reader has been initialized.
+func (b *decodedBody) init() error {
+	if b.err != nil {
+		return b.err
+	}
+
+	if b.dec == nil {
+		dec, err := b.open(b.r)
+		if err != nil {
+			if !errors.Is(err, ErrBodyTimeout) {
+				b.err = err
+			}
+			return err
+		}
+		b.dec = dec
+	}
+
+	return nil
+}
+
+func (b *decodedBody) SetReadDeadline(t time.Time) error {
+	if br, ok := b.r.(BodyReader); ok {
+		return br.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (b *decodedBody) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
+func (b *decodedBody) Close() error {
+	if b.err == nil {
+		b.err = ErrReadAfterClose
+	}
+	return b.r.Close()
+}
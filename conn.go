@@ -11,11 +11,41 @@ import (
 
 const bufferSize = 8 * 1024
 
-// Global buffer pool.
-var buffers = &sync.Pool{
-	New: func() interface{} {
-		return make([]byte, 2*bufferSize)
-	},
+// Buffer size classes, in ascending order. Buffers larger than the largest
+// class aren't pooled.
+var bufferClasses = [...]int{4 * 1024, 8 * 1024, 16 * 1024, 64 * 1024}
+
+// Global buffer pools, one per size class.
+var buffers [len(bufferClasses)]sync.Pool
+
+func init() {
+	for i := range buffers {
+		size := bufferClasses[i]
+		buffers[i].New = func() interface{} {
+			return make([]byte, size)
+		}
+	}
+}
+
+// getBuffer returns a buffer of the given length, taken from the pool of the
+// smallest size class which fits it.
+func getBuffer(size int) []byte {
+	for i, class := range bufferClasses {
+		if size <= class {
+			return buffers[i].Get().([]byte)[:size]
+		}
+	}
+	return make([]byte, size)
+}
+
+// putBuffer returns a buffer obtained from getBuffer to its pool.
+func putBuffer(buf []byte) {
+	for i, class := range bufferClasses {
+		if cap(buf) == class {
+			buffers[i].Put(buf[:class])
+			return
+		}
+	}
 }
 
 type conn struct {
@@ -23,8 +53,9 @@ type conn struct {
 	xo.Reader
 	xo.Writer
 
-	// Buffer used for this conn's xo.Reader and xo.Writer instances.
-	buf []byte
+	// Buffers used for this conn's xo.Reader and xo.Writer instances.
+	rbuf []byte
+	wbuf []byte
 
 	// The actual connection.
 	raw net.Conn
@@ -36,9 +67,20 @@ type conn struct {
 	// connection shutdown.
 	state uint32
 
+	// Set to 1 (atomically) once the connection has been closed.
+	closed uint32
+
 	// Connection identifiers.
-	tls  bool
-	addr string
+	tls bool
+	key poolKey
+
+	// Proxy to which requests on this connection are sent, unless it is
+	// a tunnel.
+	proxy *proxy
+
+	// True if this connection counts towards the Transport's
+	// MaxConnsPerHost limit.
+	counted bool
 
 	// How long has this connection been idle?
 	idleSince time.Time
@@ -76,28 +118,86 @@ func (c *conn) maybeClose(reuse bool) {
 		c.state = 0
 		c.t.putIdle(c)
 	} else {
-		c.Close()
+		c.close("not_reusable")
 	}
 }
 
-func (c *conn) Close() error {
-	// Allow the connection's buffer to be reused.
-	buffers.Put(c.buf)
+// setWriteTimeout applies the owning Transport's WriteTimeout (if any) to
+// subsequent writes.
+func (c *conn) setWriteTimeout() {
+	if c.t.WriteTimeout > 0 {
+		c.raw.SetWriteDeadline(time.Now().Add(c.t.WriteTimeout))
+	}
+}
+
+// clearWriteTimeout undoes setWriteTimeout.
+func (c *conn) clearWriteTimeout() {
+	if c.t.WriteTimeout > 0 {
+		c.raw.SetWriteDeadline(time.Time{})
+	}
+}
+
+// close closes the connection, reporting reason to the owning Transport's
+// OnConnClose hook (if any).
+func (c *conn) close(reason string) {
+	// Make sure we only close the connection (and, crucially, release its
+	// buffer) once.
+	if !atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
+		return
+	}
+
+	// Allow the connection's buffers to be reused.
+	putBuffer(c.rbuf)
+	putBuffer(c.wbuf)
 
 	c.raw.Close()
-	return nil
+
+	// Free up the connection's slot.
+	if c.counted {
+		c.t.releaseHost(c.key)
+	}
+
+	if c.t.OnConnClose != nil {
+		c.t.OnConnClose(c.key.host(), c.tls, reason)
+	}
 }
 
-func newConn(raw net.Conn, t *Transport, tls bool, addr string) *conn {
-	buf := buffers.Get().([]byte)
+func newConn(raw net.Conn, t *Transport, tls bool, key poolKey) *conn {
+	rsize, wsize := t.bufferSizes()
+
+	rbuf := getBuffer(rsize)
+	wbuf := getBuffer(wsize)
 
-	return &conn{
-		Reader: xo.NewReader(raw, buf[:bufferSize]),
-		Writer: xo.NewWriter(raw, buf[bufferSize:]),
+	c := &conn{
+		Reader: xo.NewReader(raw, rbuf),
+		Writer: xo.NewWriter(raw, wbuf),
 		raw:    raw,
-		buf:    buf,
+		rbuf:   rbuf,
+		wbuf:   wbuf,
 		t:      t,
 		tls:    tls,
-		addr:   addr,
+		key:    key,
 	}
+
+	c.SetNoDelay(!t.DisableTCPNoDelay)
+
+	return c
+}
+
+// SetNoDelay controls whether the operating system should delay sending
+// small packets in the hope of sending fewer of them (Nagle's algorithm).
+// It has no effect on connections which aren't (ultimately) TCP connections.
+func (c *conn) SetNoDelay(enable bool) error {
+	raw := c.raw
+
+	// Look beneath the TLS layer.
+	if tc, ok := raw.(interface{ NetConn() net.Conn }); ok {
+		raw = tc.NetConn()
+	}
+
+	if tc, ok := raw.(*net.TCPConn); ok {
+		return tc.SetNoDelay(enable)
+	}
+
+	return nil
 }
@@ -0,0 +1,39 @@
+package wire
+
+import (
+	"context"
+
+	"github.com/erkl/heat"
+)
+
+type connTagKey struct{}
+
+// ContextWithConnTag returns a copy of ctx carrying tag. A Transport only uses
+// a connection for requests whose contexts carry the same tag as the request
+// the connection was established for, which allows connections to the same
+// host to be partitioned (e.g. by tenant or credential).
+//
+// Connections with different tags also count separately towards the
+// Transport's MaxIdleConnsPerHost and MaxConnsPerHost limits.
+func ContextWithConnTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, connTagKey{}, tag)
+}
+
+// connTagFrom returns the connection tag carried by ctx, if any.
+func connTagFrom(ctx context.Context) string {
+	tag, _ := ctx.Value(connTagKey{}).(string)
+	return tag
+}
+
+// ConnTagMiddleware returns a Middleware which tags requests' connections
+// (see ContextWithConnTag) with the string stored in their contexts under
+// key, such as a tenant ID. Requests without a (non-empty) string under key
+// are passed on unchanged.
+func ConnTagMiddleware(key interface{}) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if tag, _ := ctx.Value(key).(string); tag != "" {
+			ctx = ContextWithConnTag(ctx, tag)
+		}
+		return next.RoundTrip(ctx, req)
+	}
+}
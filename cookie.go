@@ -0,0 +1,98 @@
+package wire
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+// A CookieJar stores cookies received in responses, and hands them out for
+// use in subsequent requests. URLs are absolute, of the form
+// "scheme://host/path?query".
+type CookieJar interface {
+	Cookies(url string) []*http.Cookie
+	SetCookies(url string, cookies []*http.Cookie)
+}
+
+// FromHTTPCookieJar adapts an http.CookieJar (such as one created by the
+// net/http/cookiejar package) to the CookieJar interface.
+func FromHTTPCookieJar(jar http.CookieJar) CookieJar {
+	return httpCookieJar{jar}
+}
+
+type httpCookieJar struct {
+	jar http.CookieJar
+}
+
+func (j httpCookieJar) Cookies(rawurl string) []*http.Cookie {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil
+	}
+	return j.jar.Cookies(u)
+}
+
+func (j httpCookieJar) SetCookies(rawurl string, cookies []*http.Cookie) {
+	if u, err := url.Parse(rawurl); err == nil {
+		j.jar.SetCookies(u, cookies)
+	}
+}
+
+// CookieJarMiddleware returns a Middleware which adds the cookies held by jar
+// for each request's URL to its Cookie header field, and stores cookies set
+// by responses (using Set-Cookie header fields) in jar. Cookies are added to a
+// copy of the request.
+func CookieJarMiddleware(jar CookieJar) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		u := req.Scheme + "://" + req.Remote + req.URI
+
+		if cookies := jar.Cookies(u); len(cookies) > 0 {
+			pairs := make([]string, 0, len(cookies)+1)
+			if v, ok := req.Fields.Get("Cookie"); ok && v != "" {
+				pairs = append(pairs, v)
+			}
+			for _, c := range cookies {
+				pairs = append(pairs, (&http.Cookie{Name: c.Name, Value: c.Value}).String())
+			}
+
+			// Leave the caller's request alone, so the jar's cookies aren't
+			// added again if it's sent again.
+			dup := *req
+			dup.Fields = append(heat.Fields(nil), req.Fields...)
+			dup.Fields.Set("Cookie", strings.Join(pairs, "; "))
+			req = &dup
+		}
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		if cookies := readSetCookies(resp.Fields); len(cookies) > 0 {
+			jar.SetCookies(u, cookies)
+		}
+
+		return resp, nil
+	}
+}
+
+// readSetCookies parses all Set-Cookie header fields in fields.
+func readSetCookies(fields heat.Fields) []*http.Cookie {
+	var lines []string
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, "Set-Cookie") {
+			lines = append(lines, f.Value)
+		}
+	}
+
+	if lines == nil {
+		return nil
+	}
+
+	// Let net/http do the actual parsing.
+	r := http.Response{Header: http.Header{"Set-Cookie": lines}}
+	return r.Cookies()
+}
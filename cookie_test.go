@@ -0,0 +1,36 @@
+package wire
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+// staticJar always hands out the same cookies.
+type staticJar []*http.Cookie
+
+func (j staticJar) Cookies(url string) []*http.Cookie             { return j }
+func (j staticJar) SetCookies(url string, cookies []*http.Cookie) {}
+
+func TestCookieJarResend(t *testing.T) {
+	mw := CookieJarMiddleware(staticJar{{Name: "jar", Value: "1"}})
+
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		if v, _ := req.Fields.Get("Cookie"); v != "own=1; jar=1" {
+			t.Errorf("request sent with Cookie %q", v)
+		}
+		return &heat.Response{Status: 204}, nil
+	})
+
+	req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+	req.Fields.Set("Cookie", "own=1")
+
+	// Send the request twice, as RetryMiddleware would.
+	for i := 0; i < 2; i++ {
+		if _, err := mw(context.Background(), req, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
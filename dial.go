@@ -0,0 +1,249 @@
+package wire
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var ErrDialTimeout = errors.New("timed out establishing connection")
+
+// Cached DNS lookup result.
+type dnsEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// dialTCP is the dial function used when Transport.Dial is nil.
+func (t *Transport) dialTCP(addr string) (net.Conn, error) {
+	d := net.Dialer{
+		Timeout:   t.DialTimeout,
+		LocalAddr: t.LocalAddr,
+	}
+	network := t.network()
+
+	if t.DNSCacheTTL <= 0 {
+		return d.Dial(network, addr)
+	}
+
+	return t.dialResolved(addr, func(addr string) (net.Conn, error) {
+		return d.Dial(network, addr)
+	})
+}
+
+// dialResolved resolves the host part of addr, and calls dial with each of
+// its addresses (of the preferred family) in turn until one succeeds.
+func (t *Transport) dialResolved(addr string, dial func(addr string) (net.Conn, error)) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := t.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if ips = filterFamily(ips, t.network()); len(ips) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+
+	// Try each address in turn.
+	for _, ip := range ips {
+		var c net.Conn
+		if c, err = dial(net.JoinHostPort(ip.String(), port)); err == nil {
+			return c, nil
+		}
+	}
+
+	return nil, err
+}
+
+// network returns the network name to pass to net.Dial.
+func (t *Transport) network() string {
+	if t.PreferNetwork != "" {
+		return t.PreferNetwork
+	}
+	return "tcp"
+}
+
+// filterFamily returns those addresses in ips which belong to the address
+// family of network ("tcp4" or "tcp6"). Other networks match any address.
+func filterFamily(ips []net.IP, network string) []net.IP {
+	if network != "tcp4" && network != "tcp6" {
+		return ips
+	}
+
+	var out []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (network == "tcp4") {
+			out = append(out, ip)
+		}
+	}
+
+	return out
+}
+
+// dialTLS is the dial function used when Transport.DialTLS is nil.
+func (t *Transport) dialTLS(addr string) (net.Conn, error) {
+	return t.dialTLSConfig(addr, nil)
+}
+
+// dialTLSConfig establishes a TLS connection using cfg, or TLSClientConfig if
+// cfg is nil.
+func (t *Transport) dialTLSConfig(addr string, cfg *tls.Config) (net.Conn, error) {
+	raw, err := t.dialer()(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tc, err := t.handshake(raw, addr, cfg)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+// dialer returns the function used to establish plain TCP connections.
+func (t *Transport) dialer() func(addr string) (net.Conn, error) {
+	if t.Dial != nil {
+		dial := withTimeout(t.Dial, t.DialTimeout)
+		if t.PreferNetwork == "" {
+			return dial
+		}
+		return func(addr string) (net.Conn, error) {
+			return t.dialResolved(addr, dial)
+		}
+	}
+	return t.dialTCP
+}
+
+// withTimeout wraps a user-supplied dial function, making it give up with
+// ErrDialTimeout after the specified timeout. Connections established after
+// the timeout are closed.
+func withTimeout(dial func(addr string) (net.Conn, error), timeout time.Duration) func(addr string) (net.Conn, error) {
+	if timeout <= 0 {
+		return dial
+	}
+
+	return func(addr string) (net.Conn, error) {
+		var ch = make(chan dialResult, 1)
+		var syn uint32
+
+		go func() {
+			c, err := dial(addr)
+			if atomic.CompareAndSwapUint32(&syn, 0, 1) {
+				ch <- dialResult{c, err}
+			} else if err == nil {
+				c.Close()
+			}
+		}()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case r := <-ch:
+			return r.c, r.err
+
+		case <-timer.C:
+			// If the dial completed just now, use the result anyway.
+			if !atomic.CompareAndSwapUint32(&syn, 0, 1) {
+				r := <-ch
+				return r.c, r.err
+			}
+			return nil, ErrDialTimeout
+		}
+	}
+}
+
+// handshake performs a TLS handshake over raw, using base, or
+// t.TLSClientConfig if base is nil.
+func (t *Transport) handshake(raw net.Conn, addr string, base *tls.Config) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if base == nil {
+		base = t.TLSClientConfig
+	}
+
+	var cfg *tls.Config
+	if base != nil {
+		cfg = base.Clone()
+	} else {
+		cfg = new(tls.Config)
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if t.ForceAttemptHTTP2 && len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = []string{"h2"}
+	}
+
+	// Limit how long the handshake may take, without affecting any
+	// subsequent I/O.
+	if t.TLSHandshakeTimeout > 0 {
+		raw.SetDeadline(time.Now().Add(t.TLSHandshakeTimeout))
+		defer raw.SetDeadline(time.Time{})
+	}
+
+	tc := tls.Client(raw, cfg)
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+// resolve looks up the IP addresses of host, consulting the DNS cache first.
+func (t *Transport) resolve(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	now := time.Now()
+
+	t.dnsMu.Lock()
+	e, ok := t.dnsCache[host]
+	t.dnsMu.Unlock()
+
+	if ok && now.Before(e.expires) {
+		return e.ips, nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.DNSCacheTTL <= 0 {
+		return ips, nil
+	}
+
+	t.dnsMu.Lock()
+	if t.dnsCache == nil {
+		t.dnsCache = make(map[string]dnsEntry)
+	}
+
+	// Sweep out expired entries (at most once per TTL period), so that the
+	// cache only holds hosts which have been resolved recently.
+	if now.Sub(t.dnsPruned) >= t.DNSCacheTTL {
+		for h, e := range t.dnsCache {
+			if !now.Before(e.expires) {
+				delete(t.dnsCache, h)
+			}
+		}
+		t.dnsPruned = now
+	}
+
+	t.dnsCache[host] = dnsEntry{ips, now.Add(t.DNSCacheTTL)}
+	t.dnsMu.Unlock()
+
+	return ips, nil
+}
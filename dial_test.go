@@ -0,0 +1,27 @@
+package wire
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDNSCachePrune(t *testing.T) {
+	tr := &Transport{DNSCacheTTL: time.Minute}
+	tr.dnsCache = map[string]dnsEntry{
+		"stale.example.com": {nil, time.Now().Add(-time.Second)},
+		"fresh.example.com": {nil, time.Now().Add(time.Minute)},
+	}
+
+	if _, err := tr.resolve("localhost"); err != nil {
+		t.Skip(err)
+	}
+
+	if _, ok := tr.dnsCache["stale.example.com"]; ok {
+		t.Error("expired entry wasn't removed")
+	}
+	for _, host := range []string{"fresh.example.com", "localhost"} {
+		if _, ok := tr.dnsCache[host]; !ok {
+			t.Errorf("entry for %s is missing", host)
+		}
+	}
+}
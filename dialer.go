@@ -0,0 +1,79 @@
+package wire
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+var ErrNoDialers = errors.New("no dial functions to fall back on")
+
+// DialerConfig configures a Dialer.
+type DialerConfig struct {
+	// ConnectTimeout limits how long establishing a connection (including
+	// the TLS handshake, if any) may take. If zero, there is no timeout.
+	ConnectTimeout time.Duration
+
+	// KeepAlive specifies the interval between TCP keep-alive probes. If
+	// zero, the operating system's default is used.
+	KeepAlive time.Duration
+
+	// LocalAddr is the local address to dial from. If nil, one is picked
+	// automatically.
+	LocalAddr net.Addr
+
+	// TLSConfig is the configuration used by DialTLS. If nil, the default
+	// configuration is used.
+	TLSConfig *tls.Config
+}
+
+// A Dialer establishes plain TCP and TLS connections. Its Dial and DialTLS
+// methods can be assigned directly to the corresponding Transport fields:
+//
+//	d := wire.NewDialer(wire.DialerConfig{ConnectTimeout: 5 * time.Second})
+//	t := &wire.Transport{Dial: d.Dial, DialTLS: d.DialTLS}
+type Dialer struct {
+	d   net.Dialer
+	cfg *tls.Config
+}
+
+// NewDialer returns a new Dialer configured by cfg.
+func NewDialer(cfg DialerConfig) *Dialer {
+	return &Dialer{
+		d: net.Dialer{
+			Timeout:   cfg.ConnectTimeout,
+			KeepAlive: cfg.KeepAlive,
+			LocalAddr: cfg.LocalAddr,
+		},
+		cfg: cfg.TLSConfig,
+	}
+}
+
+// Dial establishes a plain TCP connection with addr.
+func (d *Dialer) Dial(addr string) (net.Conn, error) {
+	return d.d.Dial("tcp", addr)
+}
+
+// DialTLS establishes a TLS connection with addr.
+func (d *Dialer) DialTLS(addr string) (net.Conn, error) {
+	return tls.DialWithDialer(&d.d, "tcp", addr, d.cfg)
+}
+
+// FallbackDialer returns a dial function which tries each of dialers in turn,
+// returning the first connection to be established. If all of them fail, the
+// last error is returned.
+func FallbackDialer(dialers ...func(addr string) (net.Conn, error)) func(addr string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		var err error = ErrNoDialers
+
+		for _, dial := range dialers {
+			var c net.Conn
+			if c, err = dial(addr); err == nil {
+				return c, nil
+			}
+		}
+
+		return nil, err
+	}
+}
@@ -0,0 +1,177 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/erkl/heat"
+	"github.com/erkl/xo"
+)
+
+var ErrBodyConsumed = errors.New("body has already been consumed")
+
+// DumpRequest returns the wire representation of req. If body is true, the
+// request body is included, in which case it's read into memory and replaced
+// with an equivalent reader. Dumping the body of a request whose body has
+// already been consumed fails with ErrBodyConsumed.
+//
+// Like Transport, DumpRequest uses chunked encoding for bodies of unknown
+// length (adding a "Transfer-Encoding: chunked" field to the dump only).
+func DumpRequest(req *heat.Request, body bool) ([]byte, error) {
+	size, err := heat.RequestBodySize(req)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := req
+	if unsizedBody(req, size) {
+		size = heat.Chunked
+
+		r := *req
+		r.Fields = append(heat.Fields(nil), req.Fields...)
+		r.Fields.Set("Transfer-Encoding", "chunked")
+		hdr = &r
+	}
+
+	var data []byte
+	if body && size != 0 {
+		if data, err = readBody(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+
+	return dump(func(w xo.Writer) error {
+		return heat.WriteRequestHeader(w, hdr)
+	}, data, size, body)
+}
+
+// DumpResponse is like DumpRequest, but for responses. A response with a nil
+// Body (such as a response to a HEAD request) is dumped without a body,
+// whatever its header fields say.
+func DumpResponse(resp *heat.Response, body bool) ([]byte, error) {
+	var size heat.BodySize
+	var err error
+
+	if resp.Body != nil {
+		if size, err = heat.ResponseBodySize(resp, "GET"); err != nil {
+			return nil, err
+		}
+	}
+
+	var data []byte
+	if body && size != 0 {
+		if data, err = readBody(resp.Body); err != nil {
+			return nil, err
+		}
+		resp.Body = newBytesBody(data)
+	}
+
+	return dump(func(w xo.Writer) error {
+		return heat.WriteResponseHeader(w, resp)
+	}, data, size, body)
+}
+
+// readBody reads r in its entirety and closes it.
+func readBody(r io.ReadCloser) ([]byte, error) {
+	if r == nil {
+		return nil, ErrBodyConsumed
+	}
+
+	// Response bodies which have been read to the end, or closed, would
+	// otherwise look empty.
+	if b, ok := r.(*body); ok && b.err != nil && len(b.peeked) == 0 {
+		return nil, ErrBodyConsumed
+	}
+
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+
+	if err == ErrReadAfterClose {
+		return nil, ErrBodyConsumed
+	}
+
+	return data, err
+}
+
+// dump serializes a message header using writeHeader, followed by data
+// (encoded according to size) if body is true.
+func dump(writeHeader func(w xo.Writer) error, data []byte, size heat.BodySize, body bool) ([]byte, error) {
+	var buf bytes.Buffer
+	w := xo.NewWriter(&buf, make([]byte, bufferSize))
+
+	if err := writeHeader(w); err != nil {
+		return nil, err
+	}
+
+	if body && size != 0 {
+		if err := heat.WriteBody(w, bytes.NewReader(data), size); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DumpMiddleware returns a Middleware which writes each request and response
+// to w in the style of "curl -v": requests prefixed by "> ", responses by
+// "< ", and errors by "* ". Bodies are included if dumpBody is true, in which
+// case they are read into memory before being passed on. Writes to w are
+// serialized, so a single writer can be shared by concurrent round-trips.
+func DumpMiddleware(w io.Writer, dumpBody bool) Middleware {
+	var mu sync.Mutex
+
+	write := func(prefix string, data []byte) {
+		var buf bytes.Buffer
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			if len(line) > 0 {
+				buf.WriteString(prefix)
+				buf.Write(line)
+			}
+		}
+		if n := buf.Len(); n > 0 && buf.Bytes()[n-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+
+		mu.Lock()
+		w.Write(buf.Bytes())
+		mu.Unlock()
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		// Failing to dump the request means its body can't be sent either.
+		data, err := DumpRequest(req, dumpBody)
+		if err != nil {
+			write("* ", []byte(err.Error()))
+			return nil, err
+		}
+
+		write("> ", data)
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			write("* ", []byte(err.Error()))
+			return nil, err
+		}
+
+		// The response body is likely to be unusable after a failed dump.
+		if data, err = DumpResponse(resp, dumpBody); err != nil {
+			write("* ", []byte(err.Error()))
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+			return nil, err
+		}
+
+		write("< ", data)
+		return resp, nil
+	}
+}
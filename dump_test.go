@@ -0,0 +1,86 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+func TestDumpRequestUnsizedBody(t *testing.T) {
+	req := &heat.Request{Method: "POST", URI: "/", Major: 1, Minor: 1}
+	req.Fields.Set("Host", "example.com")
+	req.Body = ioutil.NopCloser(strings.NewReader("hello"))
+
+	data, err := DumpRequest(req, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"
+	if string(data) != want {
+		t.Errorf("DumpRequest returned %q, want %q", data, want)
+	}
+	if req.Fields.Has("Transfer-Encoding") {
+		t.Error("DumpRequest added Transfer-Encoding to the request")
+	}
+}
+
+func TestDumpResponseWithoutBody(t *testing.T) {
+	// A response to a HEAD request.
+	resp := &heat.Response{Major: 1, Minor: 1, Status: 200, Reason: "OK"}
+	resp.Fields.Set("Content-Length", "1234")
+
+	data, err := DumpResponse(resp, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "HTTP/1.1 200 OK\r\nContent-Length: 1234\r\n\r\n"
+	if string(data) != want {
+		t.Errorf("DumpResponse returned %q, want %q", data, want)
+	}
+}
+
+// failingBody returns some data, then fails.
+type failingBody struct {
+	data   string
+	closed bool
+}
+
+func (b *failingBody) Read(buf []byte) (int, error) {
+	if b.data == "" {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(buf, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func (b *failingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDumpMiddlewareBodyError(t *testing.T) {
+	mw := DumpMiddleware(ioutil.Discard, true)
+
+	body := &failingBody{data: "partial"}
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		resp := &heat.Response{Major: 1, Minor: 1, Status: 200, Reason: "OK", Body: body}
+		resp.Fields.Set("Content-Length", "100")
+		return resp, nil
+	})
+
+	req := &heat.Request{Method: "GET", URI: "/", Major: 1, Minor: 1}
+	resp, err := mw(context.Background(), req, next)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("round-trip returned (%v, %v), want %v", resp, err, io.ErrUnexpectedEOF)
+	}
+	if !body.closed {
+		t.Error("response body wasn't closed")
+	}
+}
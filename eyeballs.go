@@ -0,0 +1,130 @@
+package wire
+
+import (
+	"net"
+	"time"
+)
+
+// DefaultHappyEyeballsStagger is the delay between connection attempts
+// recommended by RFC 8305.
+const DefaultHappyEyeballsStagger = 250 * time.Millisecond
+
+// NewHappyEyeballsDialer returns a dial function, suitable for use as
+// Transport.Dial, which implements the "Happy Eyeballs" algorithm (RFC 8305).
+//
+// When a host resolves to multiple addresses, they are tried in turn,
+// alternating between IPv6 and IPv4, starting a new attempt every stagger
+// (or as soon as the previous attempt fails). The first connection to be
+// established is returned, and the rest are closed.
+func NewHappyEyeballsDialer(stagger time.Duration) func(addr string) (net.Conn, error) {
+	if stagger <= 0 {
+		stagger = DefaultHappyEyeballsStagger
+	}
+
+	return func(addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else if ips, err = net.LookupIP(host); err != nil {
+			return nil, err
+		}
+
+		return raceDial(interleave(ips), port, stagger)
+	}
+}
+
+type dialResult struct {
+	c   net.Conn
+	err error
+}
+
+func raceDial(ips []net.IP, port string, stagger time.Duration) (net.Conn, error) {
+	var ch = make(chan dialResult, len(ips))
+	var next, pending int
+	var err error
+
+	start := func() {
+		addr := net.JoinHostPort(ips[next].String(), port)
+		go func() {
+			c, err := net.Dial("tcp", addr)
+			ch <- dialResult{c, err}
+		}()
+
+		next++
+		pending++
+	}
+
+	start()
+
+	for {
+		var delay <-chan time.Time
+		if next < len(ips) {
+			delay = time.After(stagger)
+		}
+
+		select {
+		case r := <-ch:
+			pending--
+
+			if r.err == nil {
+				// Close any connections established by the attempts
+				// still in progress.
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-ch; r.c != nil {
+							r.c.Close()
+						}
+					}
+				}(pending)
+
+				return r.c, nil
+			}
+
+			err = r.err
+
+			// Don't wait for the stagger delay after a failure.
+			if next < len(ips) {
+				start()
+			} else if pending == 0 {
+				return nil, err
+			}
+
+		case <-delay:
+			start()
+		}
+	}
+}
+
+// interleave reorders a list of IP addresses so that they alternate between
+// IPv6 and IPv4, starting with IPv6.
+func interleave(ips []net.IP) []net.IP {
+	var v4, v6 []net.IP
+
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	out := make([]net.IP, 0, len(ips))
+
+	for len(v4) > 0 || len(v6) > 0 {
+		if len(v6) > 0 {
+			out = append(out, v6[0])
+			v6 = v6[1:]
+		}
+		if len(v4) > 0 {
+			out = append(out, v4[0])
+			v4 = v4[1:]
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,144 @@
+package wire
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+// ForwardedInfo describes the original request being forwarded by a reverse
+// proxy.
+type ForwardedInfo struct {
+	// For is the address of the client which made the original request,
+	// with or without a port.
+	For string
+
+	// Proto and Host are the scheme and Host header field of the original
+	// request.
+	Proto string
+	Host  string
+}
+
+type forwardedKey struct{}
+
+// ContextWithForwarded returns a copy of ctx carrying info, for use by
+// ForwardedHeadersMiddleware.
+func ContextWithForwarded(ctx context.Context, info ForwardedInfo) context.Context {
+	return context.WithValue(ctx, forwardedKey{}, info)
+}
+
+// ForwardedHeadersOptions configures ForwardedHeadersMiddleware.
+type ForwardedHeadersOptions struct {
+	// TrustIncoming specifies whether X-Forwarded-* and Forwarded header
+	// fields already present on requests can be trusted. If not, they are
+	// removed before new ones are added.
+	TrustIncoming bool
+
+	// Append specifies whether to add to trusted X-Forwarded-For and
+	// Forwarded header fields (as when chaining proxies), rather than
+	// replacing them. When appending, existing X-Forwarded-Proto and
+	// X-Forwarded-Host fields are also kept, as they describe the first
+	// proxy's original request.
+	Append bool
+}
+
+var forwardedFields = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+}
+
+// ForwardedHeadersMiddleware returns a Middleware which describes the
+// original request, as given by the ForwardedInfo in the request's context
+// (see ContextWithForwarded), using the X-Forwarded-For, X-Forwarded-Proto,
+// X-Forwarded-Host and Forwarded (RFC 7239) header fields. Requests whose
+// context carries no ForwardedInfo are passed on as-is. The header fields are
+// set on a copy of the request.
+func ForwardedHeadersMiddleware(opts ForwardedHeadersOptions) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		info, ok := ctx.Value(forwardedKey{}).(ForwardedInfo)
+		if !ok {
+			return next.RoundTrip(ctx, req)
+		}
+
+		// Work on a copy, so that sending the caller's request again (as
+		// RetryMiddleware and RedirectMiddleware do) doesn't append the
+		// same values again.
+		dup := *req
+		dup.Fields = append(heat.Fields(nil), req.Fields...)
+
+		if !opts.TrustIncoming {
+			for _, name := range forwardedFields {
+				dup.Fields.Del(name)
+			}
+		}
+
+		appending := opts.TrustIncoming && opts.Append
+		set := func(name, value string, sep string) {
+			if value == "" {
+				return
+			}
+			if prev, ok := dup.Fields.Get(name); ok && appending {
+				if sep == "" {
+					return
+				}
+				value = prev + sep + value
+			}
+			dup.Fields.Set(name, value)
+		}
+
+		set("X-Forwarded-For", stripPort(info.For), ", ")
+		set("X-Forwarded-Proto", info.Proto, "")
+		set("X-Forwarded-Host", info.Host, "")
+		set("Forwarded", forwardedElement(info), ", ")
+
+		return next.RoundTrip(ctx, &dup)
+	}
+}
+
+// forwardedElement formats info as a Forwarded header field element.
+func forwardedElement(info ForwardedInfo) string {
+	var pairs []string
+
+	if info.For != "" {
+		pairs = append(pairs, "for="+forwardedNode(info.For))
+	}
+	if info.Proto != "" {
+		pairs = append(pairs, "proto="+info.Proto)
+	}
+	if info.Host != "" {
+		pairs = append(pairs, "host="+quoteForwarded(info.Host))
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+// forwardedNode formats addr as a Forwarded node identifier, which requires
+// IPv6 addresses to be bracketed, and the result to be quoted if it contains
+// a colon or brackets.
+func forwardedNode(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+
+	if strings.IndexByte(host, ':') >= 0 {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+
+	return quoteForwarded(host)
+}
+
+// quoteForwarded quotes v if it isn't a valid token.
+func quoteForwarded(v string) string {
+	if strings.ContainsAny(v, ":[]\"\\ ;,=") {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	}
+	return v
+}
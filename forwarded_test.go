@@ -0,0 +1,35 @@
+package wire
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+func TestForwardedAppendResend(t *testing.T) {
+	mw := ForwardedHeadersMiddleware(ForwardedHeadersOptions{TrustIncoming: true, Append: true})
+
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		if v, _ := req.Fields.Get("X-Forwarded-For"); v != "10.0.0.1, 10.0.0.2" {
+			t.Errorf("request sent with X-Forwarded-For %q", v)
+		}
+		if v, _ := req.Fields.Get("Forwarded"); v != `for=10.0.0.1, for="10.0.0.2:1234"` {
+			t.Errorf("request sent with Forwarded %q", v)
+		}
+		return &heat.Response{Status: 204}, nil
+	})
+
+	ctx := ContextWithForwarded(context.Background(), ForwardedInfo{For: "10.0.0.2:1234"})
+
+	req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+	req.Fields.Set("X-Forwarded-For", "10.0.0.1")
+	req.Fields.Set("Forwarded", "for=10.0.0.1")
+
+	// Send the request twice, as RetryMiddleware would.
+	for i := 0; i < 2; i++ {
+		if _, err := mw(ctx, req, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
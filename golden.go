@@ -0,0 +1,97 @@
+package wire
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/erkl/heat"
+)
+
+var ErrNoGoldenFile = errors.New("no golden file recorded for request")
+
+// GoldenMiddleware returns a Middleware for golden-file tests. If update is
+// true, requests are passed on, and each round-trip is recorded to a JSON file
+// in dir (which is created if necessary), named after a hash of the request's
+// method, URL and body. If update is false, round-trips are replayed from
+// those files without passing requests on; requests for which no file exists
+// fail with ErrNoGoldenFile.
+//
+// Header fields aren't part of the hash, so requests which differ only in
+// their header fields share a golden file. Request header fields carrying
+// credentials are redacted, and errors are replayed as by PlaybackTransport.
+// Request and response bodies are read into memory in their entirety.
+func GoldenMiddleware(dir string, update bool) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if !update {
+			return replayGolden(dir, req)
+		}
+
+		rec, resp, err := record(ctx, next, req)
+		if rec == nil {
+			return nil, err
+		}
+
+		data, merr := json.MarshalIndent(rec, "", "\t")
+		if merr != nil {
+			return nil, merr
+		}
+
+		if merr = os.MkdirAll(dir, 0755); merr != nil {
+			return nil, merr
+		}
+
+		name := goldenName(&rec.Request)
+		if merr = ioutil.WriteFile(filepath.Join(dir, name), append(data, '\n'), 0644); merr != nil {
+			return nil, merr
+		}
+
+		return resp, err
+	}
+}
+
+// replayGolden responds to req with the round-trip recorded in its golden
+// file.
+func replayGolden(dir string, req *heat.Request) (*heat.Response, error) {
+	r := recordedRequest{
+		Method: req.Method,
+		URL:    req.Scheme + "://" + req.Remote + req.URI,
+	}
+
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = data
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, goldenName(&r)))
+	if os.IsNotExist(err) {
+		return nil, ErrNoGoldenFile
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+
+	return rec.replay()
+}
+
+// goldenName returns the name of the golden file for a recorded request.
+func goldenName(r *recordedRequest) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL + "\n"))
+	h.Write(r.Body)
+
+	return hex.EncodeToString(h.Sum(nil)[:16]) + ".json"
+}
@@ -0,0 +1,77 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A HealthCheckError describes why HealthCheck failed.
+type HealthCheckError struct {
+	// Status is the response status code, or zero if no response was
+	// received (in which case Err describes why).
+	Status int
+	Err    error
+}
+
+func (e *HealthCheckError) Error() string {
+	if e.Err != nil {
+		return "health check failed: " + e.Err.Error()
+	}
+	return fmt.Sprintf("health check failed: unexpected response status %d", e.Status)
+}
+
+func (e *HealthCheckError) Unwrap() error { return e.Err }
+
+// Network reports whether the check failed because no response was received,
+// as opposed to the server responding with a non-2xx status.
+func (e *HealthCheckError) Network() bool { return e.Status == 0 }
+
+type healthConfig struct {
+	timeout time.Duration
+}
+
+// A HealthCheckOption configures HealthCheck.
+type HealthCheckOption func(*healthConfig)
+
+// WithHealthCheckTimeout limits how long HealthCheck waits for a response.
+func WithHealthCheckTimeout(d time.Duration) HealthCheckOption {
+	return func(cfg *healthConfig) { cfg.timeout = d }
+}
+
+// HealthCheck issues a HEAD request for url using rt, and returns nil if the
+// server responds with a 2XX status. Otherwise it returns a
+// *HealthCheckError.
+func HealthCheck(rt RoundTripper, url string, opts ...HealthCheckOption) error {
+	var cfg healthConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	req, err := NewRequest("HEAD", url, nil)
+	if err != nil {
+		return &HealthCheckError{Err: err}
+	}
+
+	ctx := context.Background()
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	resp, err := rt.RoundTrip(ctx, req)
+	if err != nil {
+		return &HealthCheckError{Err: err}
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	if resp.Status < 200 || resp.Status > 299 {
+		return &HealthCheckError{Status: resp.Status}
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package wire
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHealthCheckInvalidURL(t *testing.T) {
+	err := HealthCheck(notImplemented, "example.com/health")
+
+	var herr *HealthCheckError
+	if !errors.As(err, &herr) {
+		t.Fatalf("HealthCheck returned %v, want a *HealthCheckError", err)
+	}
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("HealthCheck returned %v, want it to wrap %v", err, ErrInvalidURL)
+	}
+}
@@ -0,0 +1,116 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+var ErrUpgradeRefused = errors.New("server refused protocol upgrade")
+
+// Hijack issues a protocol upgrade request (defaulting to "Upgrade: websocket"
+// if req has no Upgrade header) and, if the server responds with "101
+// Switching Protocols", hands the underlying connection over to the caller.
+// The Transport won't touch the connection again; closing it is the caller's
+// responsibility.
+//
+// If the server responds with any other status code, the response (including
+// its body, which the caller must close) is returned along with
+// ErrUpgradeRefused. The request must not have a body, and isn't modified.
+//
+// Only ctx's deadline (rather than cancellation) is respected once the
+// connection has been established.
+func (t *Transport) Hijack(ctx context.Context, req *heat.Request) (net.Conn, *heat.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	if !req.Fields.Has("Upgrade") {
+		dup := *req
+		dup.Fields = append(heat.Fields(nil), req.Fields...)
+		dup.Fields.Set("Upgrade", "websocket")
+		dup.Fields.Set("Connection", "Upgrade")
+		req = &dup
+	}
+
+	c, err := t.dial(ctx, req.Scheme, req.Remote)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		c.raw.SetDeadline(d)
+	}
+
+	resp, err := hijack(c, req)
+	if err != nil {
+		c.close("error")
+		return nil, nil, err
+	}
+
+	if resp.Status != 101 {
+		if err := refused(c, req, resp); err != nil {
+			c.close("error")
+			return nil, nil, err
+		}
+		return nil, resp, ErrUpgradeRefused
+	}
+
+	c.raw.SetDeadline(time.Time{})
+
+	// The connection no longer counts towards MaxConnsPerHost.
+	if c.counted {
+		c.counted = false
+		t.releaseHost(c.key)
+	}
+
+	return &hijackedConn{c.raw, c}, resp, nil
+}
+
+func hijack(c *conn, req *heat.Request) (*heat.Response, error) {
+	if err := writeRequestHeader(c, req, 0); err != nil {
+		return nil, err
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	return heat.ReadResponseHeader(c)
+}
+
+// refused attaches the body of resp (a response refusing the upgrade) so the
+// caller can inspect it. The connection is closed once the body has been
+// read.
+func refused(c *conn, req *heat.Request, resp *heat.Response) error {
+	size, err := heat.ResponseBodySize(resp, req.Method)
+	if err != nil {
+		return err
+	}
+
+	// The connection won't be reused after an upgrade attempt.
+	c.maybeClose(false)
+
+	if size != 0 {
+		r, _ := heat.OpenBody(c, size)
+		resp.Body = &body{r: r, c: c}
+	} else {
+		c.maybeClose(false)
+	}
+
+	return nil
+}
+
+// A hijackedConn reads through its conn's buffered reader, so that no bytes
+// buffered while reading the response header are lost. Writes go straight to
+// the underlying connection.
+type hijackedConn struct {
+	net.Conn
+	c *conn
+}
+
+func (h *hijackedConn) Read(buf []byte) (int, error) {
+	return h.c.Reader.Read(buf)
+}
@@ -0,0 +1,77 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/erkl/heat"
+	"github.com/erkl/xo"
+)
+
+func TestHijackDisableKeepAlives(t *testing.T) {
+	addr := testServer(t, func(c net.Conn) {
+		r := xo.NewReader(c, make([]byte, bufferSize))
+		req, err := heat.ReadRequestHeader(r)
+		if err != nil {
+			return
+		}
+
+		if v, _ := req.Fields.Get("Connection"); v != "Upgrade" {
+			io.WriteString(c, "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n")
+			return
+		}
+
+		io.WriteString(c, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		io.Copy(c, r)
+	})
+
+	tr := &Transport{DisableKeepAlives: true}
+
+	conn, _, err := tr.Hijack(context.Background(), testRequest(addr, "/ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "ping")
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read %q (err = %v) from hijacked connection, want %q", buf, err, "ping")
+	}
+}
+
+func TestHijackRefused(t *testing.T) {
+	addr := testServer(t, func(c net.Conn) {
+		r := xo.NewReader(c, make([]byte, bufferSize))
+		if _, err := heat.ReadRequestHeader(r); err != nil {
+			return
+		}
+		io.WriteString(c, "HTTP/1.1 400 Bad Request\r\nContent-Length: 11\r\n\r\nno upgrades")
+	})
+
+	tr := new(Transport)
+	req := testRequest(addr, "/ws")
+	fields := len(req.Fields)
+
+	_, resp, err := tr.Hijack(context.Background(), req)
+	if err != ErrUpgradeRefused {
+		t.Fatalf("Hijack returned %v, want %v", err, ErrUpgradeRefused)
+	}
+	if len(req.Fields) != fields {
+		t.Errorf("Hijack modified the request's header fields: %v", req.Fields)
+	}
+
+	if resp.Body == nil {
+		t.Fatal("refusal has no body")
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil || string(data) != "no upgrades" {
+		t.Fatalf("read (%q, %v) from refusal body, want %q", data, err, "no upgrades")
+	}
+}
@@ -0,0 +1,100 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// An HMACAlgorithm identifies the hash function used by HMACSigningMiddleware.
+type HMACAlgorithm int
+
+const (
+	HMACSHA256 HMACAlgorithm = iota
+	HMACSHA512
+)
+
+func (a HMACAlgorithm) String() string {
+	switch a {
+	case HMACSHA256:
+		return "HMAC-SHA256"
+	case HMACSHA512:
+		return "HMAC-SHA512"
+	default:
+		return "HMAC-" + strconv.Itoa(int(a))
+	}
+}
+
+func (a HMACAlgorithm) new() func() hash.Hash {
+	if a == HMACSHA512 {
+		return sha512.New
+	}
+	return sha256.New
+}
+
+// HMACSigningMiddleware returns a Middleware which signs requests using HMAC
+// with the given key, and attaches the signature as an Authorization header:
+//
+//	Authorization: HMAC-SHA256 timestamp=<unix time>, signature=<hex digest>
+//
+// The signature is computed over the following lines, joined by "\n": the
+// request method, the request path, the query string (with its parameters
+// sorted), the hex-encoded hash of the request body, and the timestamp.
+//
+// Request bodies are buffered in memory so that they can be hashed.
+func HMACSigningMiddleware(key []byte, algo HMACAlgorithm) Middleware {
+	newHash := algo.new()
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		// Hash the request body.
+		var buf []byte
+		if req.Body != nil {
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			buf = b
+			req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		}
+
+		h := newHash()
+		h.Write(buf)
+		sum := hex.EncodeToString(h.Sum(nil))
+
+		// Split the request URI into its path and query components, and
+		// sort the latter.
+		path, query := req.URI, ""
+		if i := strings.IndexByte(path, '?'); i >= 0 {
+			path, query = path[:i], path[i+1:]
+		}
+		if query != "" {
+			params := strings.Split(query, "&")
+			sort.Strings(params)
+			query = strings.Join(params, "&")
+		}
+
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+		// Sign the canonical request.
+		mac := hmac.New(newHash, key)
+		mac.Write([]byte(strings.Join([]string{req.Method, path, query, sum, ts}, "\n")))
+		sig := hex.EncodeToString(mac.Sum(nil))
+
+		req.Fields.Set("Authorization", algo.String()+" timestamp="+ts+", signature="+sig)
+
+		return next.RoundTrip(ctx, req)
+	}
+}
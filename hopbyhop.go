@@ -0,0 +1,72 @@
+package wire
+
+import (
+	"context"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+// Hop-by-hop header fields, which are meaningful only for a single
+// transport-level connection (RFC 7230, section 6.1).
+var hopByHop = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// HopByHopMiddleware returns a Middleware which strips hop-by-hop header
+// fields (including any listed in the Connection header) from requests before
+// passing them on, and from responses before returning them. This is needed
+// when forwarding requests and responses, as proxies and gateways do.
+//
+// The request's Transfer-Encoding header is left intact, because it
+// determines how the request body is framed.
+func HopByHopMiddleware() Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		stripHopByHop(&req.Fields, "Transfer-Encoding")
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		stripHopByHop(&resp.Fields)
+		return resp, nil
+	}
+}
+
+// stripHopByHop removes all hop-by-hop header fields from fields, except
+// those named in keep.
+func stripHopByHop(fields *heat.Fields, keep ...string) {
+	var names []string
+
+	// Fields listed in the Connection header are hop-by-hop as well.
+	for _, f := range *fields {
+		if strings.EqualFold(f.Name, "Connection") {
+			for _, name := range strings.Split(f.Value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+
+	names = append(names, hopByHop...)
+
+outer:
+	for _, name := range names {
+		for _, k := range keep {
+			if strings.EqualFold(name, k) {
+				continue outer
+			}
+		}
+		fields.Del(name)
+	}
+}
@@ -0,0 +1,94 @@
+package wire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+var ErrNotJSON = errors.New("response content type is not JSON")
+
+// An HTTPError is returned by JSONDo when the server responds with a non-2XX
+// status.
+type HTTPError struct {
+	Status int
+
+	// Body holds the first DefaultStatusBodyLimit bytes of the response
+	// body.
+	Body []byte
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("unexpected response status %d", e.Status)
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+	return msg
+}
+
+// JSONDo issues req using rt, and decodes the JSON response body into out.
+// The response is returned with its body already closed. Unless req already
+// has an Accept header field, it's set to "application/json".
+//
+// If the response status isn't 2XX, an *HTTPError is returned. Responses with
+// a Content-Type other than "application/json" (or another "+json" type)
+// fail with ErrNotJSON, and bodies longer than DefaultMaxBodySize fail with
+// ErrBodyTooLarge.
+func JSONDo(rt RoundTripper, req *heat.Request, out interface{}) (*heat.Response, error) {
+	if !req.Fields.Has("Accept") {
+		req.Fields.Set("Accept", "application/json")
+	}
+
+	resp, err := Do(rt, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Status < 200 || resp.Status > 299 {
+		e := &HTTPError{Status: resp.Status}
+		if resp.Body != nil {
+			e.Body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, DefaultStatusBodyLimit))
+			resp.Body.Close()
+			resp.Body = nil
+		}
+		return resp, e
+	}
+
+	if !isJSON(resp.Fields) {
+		if resp.Body != nil {
+			resp.Body.Close()
+			resp.Body = nil
+		}
+		return resp, ErrNotJSON
+	}
+
+	data, err := ReadResponseBody(resp)
+	resp.Body = nil
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, json.Unmarshal(data, out)
+}
+
+// isJSON reports whether the Content-Type header field in fields describes a
+// JSON document.
+func isJSON(fields heat.Fields) bool {
+	v, ok := fields.Get("Content-Type")
+	if !ok {
+		return false
+	}
+
+	mt, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		return false
+	}
+
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
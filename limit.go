@@ -0,0 +1,150 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+var ErrBodyTooLarge = errors.New("response body exceeds size limit")
+var ErrRequestBodyTooLarge = errors.New("request body exceeds size limit")
+
+// MaxBodyMiddleware returns a Middleware which limits response bodies to at
+// most limit bytes. Reading past the limit fails with ErrBodyTooLarge.
+func MaxBodyMiddleware(limit int64) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Body != nil {
+			resp.Body = &limitedBody{r: resp.Body, n: limit}
+		}
+
+		return resp, nil
+	}
+}
+
+// MaxRequestBodyMiddleware returns a Middleware which fails round-trips with
+// ErrRequestBodyTooLarge, without passing them on, if the request body is
+// longer than limit bytes.
+//
+// Requests with a Content-Length header field are checked against it
+// directly. Other request bodies (including those which will be sent using
+// chunked encoding) are read into memory, up to the limit, to find out how
+// long they are.
+func MaxRequestBodyMiddleware(limit int64) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if req.Body == nil {
+			return next.RoundTrip(ctx, req)
+		}
+
+		size, err := heat.RequestBodySize(req)
+		if err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+
+		if size >= 0 && !unsizedBody(req, size) {
+			if int64(size) > limit {
+				req.Body.Close()
+				return nil, ErrRequestBodyTooLarge
+			}
+			return next.RoundTrip(ctx, req)
+		}
+
+		// Read one byte past the limit, to tell whether there's more.
+		data, err := ioutil.ReadAll(&io.LimitedReader{R: req.Body, N: limit + 1})
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(data)) > limit {
+			return nil, ErrRequestBodyTooLarge
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// Compile-time type check.
+var _ BodyReader = new(limitedBody)
+
+type limitedBody struct {
+	// Underlying response body.
+	r io.ReadCloser
+
+	// Number of bytes remaining before the limit is reached.
+	n int64
+
+	// Persisted ErrBodyTooLarge error.
+	err error
+}
+
+func (b *limitedBody) Read(buf []byte) (int, error) {
+	// Once we've hit the limit, check whether there's actually anything
+	// left to read before complaining.
+	if b.n <= 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		var one [1]byte
+
+		n, err := b.r.Read(one[:])
+		if n > 0 {
+			b.err = ErrBodyTooLarge
+			return 0, b.err
+		}
+		return 0, err
+	}
+
+	if int64(len(buf)) > b.n {
+		buf = buf[:b.n]
+	}
+
+	n, err := b.r.Read(buf)
+	b.n -= int64(n)
+
+	return n, err
+}
+
+func (b *limitedBody) SetReadDeadline(t time.Time) error {
+	if br, ok := b.r.(BodyReader); ok {
+		return br.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (b *limitedBody) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
+func (b *limitedBody) Peek(n int) ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if int64(n) <= b.n {
+		return peekBody(b.r, n)
+	}
+
+	// Peek one byte past the limit, to tell whether there's more.
+	p, err := peekBody(b.r, int(b.n)+1)
+	if int64(len(p)) > b.n {
+		return p[:b.n], ErrBodyTooLarge
+	}
+
+	return p, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.r.Close()
+}
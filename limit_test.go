@@ -0,0 +1,47 @@
+package wire
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+func TestMaxRequestBodyMiddleware(t *testing.T) {
+	tests := []struct {
+		body   string
+		length string
+		want   error
+	}{
+		{"short", "5", nil},
+		{"much too long", "13", ErrRequestBodyTooLarge},
+		{"short", "", nil},
+		{"much too long", "", ErrRequestBodyTooLarge},
+	}
+
+	for _, tt := range tests {
+		var sent string
+
+		next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+			data, err := ioutil.ReadAll(req.Body)
+			sent = string(data)
+			return &heat.Response{Status: 200}, err
+		})
+
+		req := &heat.Request{Method: "POST", Major: 1, Minor: 1}
+		req.Body = ioutil.NopCloser(strings.NewReader(tt.body))
+		if tt.length != "" {
+			req.Fields.Set("Content-Length", tt.length)
+		}
+
+		_, err := MaxRequestBodyMiddleware(8)(context.Background(), req, next)
+		if err != tt.want {
+			t.Errorf("body %q, Content-Length %q: got error %v, want %v", tt.body, tt.length, err, tt.want)
+		}
+		if err == nil && sent != tt.body {
+			t.Errorf("body %q, Content-Length %q: sent %q", tt.body, tt.length, sent)
+		}
+	}
+}
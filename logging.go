@@ -0,0 +1,151 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// A LogEntry describes a single round-trip.
+type LogEntry struct {
+	// Request method and URL.
+	Method string
+	URL    string
+
+	// Response status code, or zero if the round-trip failed.
+	Status int
+
+	// Time until the response header was received.
+	Latency time.Duration
+
+	// Number of request body bytes written, and response body bytes read.
+	BytesWritten int64
+	BytesRead    int64
+
+	// Error returned by the round-trip, if any.
+	Err error
+}
+
+// Objects implementing the Logger interface receive log entries from
+// LoggingMiddleware.
+type Logger interface {
+	Log(entry LogEntry)
+}
+
+// LoggingMiddleware returns a Middleware which logs every round-trip.
+//
+// When a response has a body, the entry isn't logged until the body has been
+// closed, so that BytesRead can be reported accurately.
+func LoggingMiddleware(logger Logger) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		entry := LogEntry{
+			Method: req.Method,
+			URL:    req.Scheme + "://" + req.Remote + req.URI,
+		}
+
+		var w *countingReader
+		if req.Body != nil {
+			w = &countingReader{r: req.Body}
+			req.Body = w
+		}
+
+		start := time.Now()
+		resp, err := next.RoundTrip(ctx, req)
+		entry.Latency = time.Since(start)
+
+		if err != nil || resp.Body == nil {
+			if w != nil {
+				entry.BytesWritten = w.count()
+			}
+			if resp != nil {
+				entry.Status = resp.Status
+			}
+			entry.Err = err
+
+			logger.Log(entry)
+			return resp, err
+		}
+
+		entry.Status = resp.Status
+
+		resp.Body = &loggedBody{
+			countingReader: countingReader{r: resp.Body},
+			done: func(n int64) {
+				if w != nil {
+					entry.BytesWritten = w.count()
+				}
+				entry.BytesRead = n
+				logger.Log(entry)
+			},
+		}
+
+		return resp, nil
+	}
+}
+
+// countingReader wraps an io.ReadCloser, counting the bytes read through it.
+// The count is updated atomically, because request bodies are written from a
+// separate goroutine.
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(buf []byte) (int, error) {
+	n, err := c.r.Read(buf)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func (c *countingReader) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeBodyTo(w, c.r)
+	atomic.AddInt64(&c.n, n)
+	return n, err
+}
+
+func (c *countingReader) count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
+
+// Compile-time type check.
+var _ BodyReader = new(loggedBody)
+
+type loggedBody struct {
+	countingReader
+
+	// Called with the number of bytes read when the body is first closed.
+	done func(n int64)
+}
+
+func (b *loggedBody) SetReadDeadline(t time.Time) error {
+	if br, ok := b.r.(BodyReader); ok {
+		return br.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (b *loggedBody) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
+func (b *loggedBody) Peek(n int) ([]byte, error) {
+	return peekBody(b.r, n)
+}
+
+func (b *loggedBody) Close() error {
+	err := b.r.Close()
+
+	if b.done != nil {
+		b.done(b.count())
+		b.done = nil
+	}
+
+	return err
+}
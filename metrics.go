@@ -0,0 +1,71 @@
+package wire
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/erkl/heat"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusMiddleware returns a Middleware which records round-trip metrics,
+// labelled by host and method, and registers them with reg:
+//
+//	<namespace>_request_duration_seconds  histogram of round-trip latencies
+//	<namespace>_requests_total            requests by status code
+//	<namespace>_requests_in_flight        requests currently in progress
+//
+// Failed round-trips are counted with the status code "error". If any of the
+// metrics can't be registered, none of them are.
+func PrometheusMiddleware(reg prometheus.Registerer, namespace string) (Middleware, error) {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time until the response header was received.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "method"})
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Number of round-trips, by status code.",
+	}, []string{"host", "method", "code"})
+
+	inflight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "requests_in_flight",
+		Help:      "Number of round-trips currently in progress.",
+	}, []string{"host", "method"})
+
+	collectors := []prometheus.Collector{duration, requests, inflight}
+	for i, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			// Don't leave a partial set of metrics behind.
+			for _, c := range collectors[:i] {
+				reg.Unregister(c)
+			}
+			return nil, err
+		}
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		host, method := req.Remote, req.Method
+
+		g := inflight.WithLabelValues(host, method)
+		g.Inc()
+		defer g.Dec()
+
+		start := time.Now()
+		resp, err := next.RoundTrip(ctx, req)
+		duration.WithLabelValues(host, method).Observe(time.Since(start).Seconds())
+
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.Status)
+		}
+		requests.WithLabelValues(host, method, code).Inc()
+
+		return resp, err
+	}, nil
+}
@@ -0,0 +1,51 @@
+package wire
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// failingRegisterer accepts n collectors, then fails.
+type failingRegisterer struct {
+	n          int
+	registered []prometheus.Collector
+}
+
+func (r *failingRegisterer) Register(c prometheus.Collector) error {
+	if len(r.registered) >= r.n {
+		return errors.New("duplicate metrics collector registration attempted")
+	}
+	r.registered = append(r.registered, c)
+	return nil
+}
+
+func (r *failingRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *failingRegisterer) Unregister(c prometheus.Collector) bool {
+	for i, x := range r.registered {
+		if x == c {
+			r.registered = append(r.registered[:i], r.registered[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestPrometheusRegisterFailure(t *testing.T) {
+	reg := &failingRegisterer{n: 2}
+
+	if _, err := PrometheusMiddleware(reg, "test"); err == nil {
+		t.Fatal("PrometheusMiddleware succeeded")
+	}
+	if len(reg.registered) != 0 {
+		t.Fatalf("%d collectors left registered", len(reg.registered))
+	}
+}
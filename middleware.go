@@ -1,37 +1,92 @@
 package wire
 
 import (
+	"context"
+
 	"github.com/erkl/heat"
 )
 
+// Compile-time type checks.
 var _ RoundTripper = new(Transport)
+var _ RoundTripper = new(wrapped)
+var _ RoundTripper = RoundTripperFunc(nil)
 
 // Objects implementing the RoundTripper interface are capable of issuing
 // HTTP requests and returning the responses.
 type RoundTripper interface {
-	RoundTrip(req *heat.Request, cancel <-chan error) (*heat.Response, error)
+	RoundTrip(ctx context.Context, req *heat.Request) (*heat.Response, error)
+}
+
+// The RoundTripperFunc type is an adapter to allow the use of ordinary
+// functions as RoundTrippers.
+type RoundTripperFunc func(ctx context.Context, req *heat.Request) (*heat.Response, error)
+
+// RoundTrip calls fn(ctx, req).
+func (fn RoundTripperFunc) RoundTrip(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+	return fn(ctx, req)
 }
 
 // A Middleware function extends a RoundTripper with additional functionality.
-type Middleware func(req *heat.Request, cancel <-chan error, next RoundTripper) (*heat.Response, error)
+type Middleware func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error)
 
 // Wrap extends a RoundTripper with one or more pieces of middleware.
 //
 //   // These two lines are functionally equivalent.
 //   Wrap(rt, foo, bar)
 //   Wrap(Wrap(rt, bar), foo)
+//
+// If rt is nil, the innermost RoundTripper responds to all requests with
+// "501 Not Implemented".
 func Wrap(rt RoundTripper, m ...Middleware) RoundTripper {
+	if rt == nil {
+		rt = notImplemented
+	}
 	for i := len(m) - 1; i >= 0; i-- {
 		rt = &wrapped{m[i], rt}
 	}
 	return rt
 }
 
+// Chain combines several pieces of middleware into one, applied in the same
+// order as with Wrap.
+//
+//	// These two lines are functionally equivalent.
+//	Wrap(rt, Chain(foo, bar))
+//	Wrap(rt, foo, bar)
+func Chain(m ...Middleware) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		return Wrap(next, m...).RoundTrip(ctx, req)
+	}
+}
+
+// FromMiddleware turns a piece of middleware into a RoundTripper. This is
+// useful for middleware which generates responses locally (such as a mock
+// or a cache); if it ever calls the next RoundTripper, the response will be
+// "501 Not Implemented".
+func FromMiddleware(m Middleware) RoundTripper {
+	return Wrap(nil, m)
+}
+
+// The notImplemented RoundTripper responds to every request with
+// "501 Not Implemented".
+var notImplemented = RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	return &heat.Response{
+		Major:  1,
+		Minor:  1,
+		Status: 501,
+		Reason: "Not Implemented",
+	}, nil
+})
+
 type wrapped struct {
 	fn Middleware
 	rt RoundTripper
 }
 
-func (w *wrapped) RoundTrip(req *heat.Request, cancel <-chan error) (*heat.Response, error) {
-	return w.fn(req, cancel, w.rt)
+func (w *wrapped) RoundTrip(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+	return w.fn(ctx, req, w.rt)
 }
@@ -0,0 +1,143 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/erkl/heat"
+)
+
+var ErrUnexpectedRequest = errors.New("mock transport received unexpected request")
+
+// Compile-time type check.
+var _ RoundTripper = new(MockTransport)
+
+// MockTransport is a RoundTripper for use in tests. It responds to requests
+// using pre-registered expectations, and records every request it receives.
+//
+// Each expectation is used at most once, in the order they were registered.
+// Requests which don't match any remaining expectation fail with
+// ErrUnexpectedRequest.
+type MockTransport struct {
+	mu           sync.Mutex
+	expectations []*expectation
+	requests     []*heat.Request
+}
+
+type expectation struct {
+	// Request method and URL ("scheme://host/path?query"), if this
+	// expectation was registered with Expect.
+	method string
+	url    string
+
+	// Canned results.
+	resp *heat.Response
+	err  error
+
+	// Response function, if registered with ExpectFunc.
+	fn func(req *heat.Request) (*heat.Response, error)
+
+	// Has the expectation been met?
+	done bool
+}
+
+// Expect registers an expected request with the given method and URL (of the
+// form "scheme://host/path?query"), to be answered with resp and err.
+func (m *MockTransport) Expect(method, url string, resp *heat.Response, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expectations = append(m.expectations, &expectation{
+		method: method,
+		url:    url,
+		resp:   resp,
+		err:    err,
+	})
+}
+
+// ExpectFunc registers an expectation which matches any request, and is
+// answered by calling fn.
+func (m *MockTransport) ExpectFunc(fn func(req *heat.Request) (*heat.Response, error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expectations = append(m.expectations, &expectation{fn: fn})
+}
+
+func (m *MockTransport) RoundTrip(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+	m.mu.Lock()
+
+	m.requests = append(m.requests, req)
+
+	var match *expectation
+	for _, e := range m.expectations {
+		if !e.done && e.matches(req) {
+			match = e
+			match.done = true
+			break
+		}
+	}
+
+	m.mu.Unlock()
+
+	if match == nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrUnexpectedRequest
+	}
+
+	if match.fn != nil {
+		return match.fn(req)
+	}
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	return match.resp, match.err
+}
+
+func (e *expectation) matches(req *heat.Request) bool {
+	if e.fn != nil {
+		return true
+	}
+	return e.method == req.Method && e.url == req.Scheme+"://"+req.Remote+req.URI
+}
+
+// Requests returns all requests received so far, in order.
+func (m *MockTransport) Requests() []*heat.Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*heat.Request(nil), m.requests...)
+}
+
+// TestingT is the subset of testing.TB used by MockTransport, declared here
+// so that the testing package isn't linked into programs importing wire.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertExpectations reports an error to t for each registered expectation
+// which hasn't been met.
+func (m *MockTransport) AssertExpectations(t TestingT) {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.expectations {
+		if e.done {
+			continue
+		}
+
+		if e.fn != nil {
+			t.Errorf("wire: expected request (ExpectFunc) was never made")
+		} else {
+			t.Errorf("wire: expected request %s %s was never made", e.method, e.url)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package wire
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/erkl/heat"
+)
+
+// MTLSMiddleware returns a Middleware which makes HTTPS requests over
+// mutually authenticated TLS connections: the client presents cert, and the
+// server's certificate is verified against caPool (or the system roots, if
+// caPool is nil).
+//
+// The TLS configuration is carried to the Transport through the request's
+// context. Connections established with it are pooled separately from other
+// connections, and are always established using the Transport's built-in TLS
+// dialer, even when DialTLS is set.
+func MTLSMiddleware(cert tls.Certificate, caPool *x509.CertPool) Middleware {
+	return MTLSFuncMiddleware(func() (*tls.Certificate, error) {
+		return &cert, nil
+	}, caPool)
+}
+
+// MTLSFuncMiddleware is like MTLSMiddleware, except the client certificate is
+// obtained by calling getCert during each TLS handshake, allowing
+// certificates to be rotated without replacing the middleware.
+func MTLSFuncMiddleware(getCert func() (*tls.Certificate, error), caPool *x509.CertPool) Middleware {
+	cfg := &tls.Config{
+		RootCAs:    caPool,
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return getCert()
+		},
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if req.Scheme == "https" {
+			ctx = context.WithValue(ctx, tlsConfigKey{}, cfg)
+		}
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+type tlsConfigKey struct{}
+
+// tlsConfigFrom returns the TLS configuration carried by ctx, if any.
+func tlsConfigFrom(ctx context.Context) *tls.Config {
+	cfg, _ := ctx.Value(tlsConfigKey{}).(*tls.Config)
+	return cfg
+}
@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+var ErrContentTypeMismatch = errors.New("response content type was not accepted")
+
+// ContentTypeMismatchError is returned by ContentNegotiationMiddleware when a
+// response's Content-Type isn't one of those accepted. It matches
+// ErrContentTypeMismatch when used with errors.Is.
+type ContentTypeMismatchError struct {
+	Expected []string
+	Received string
+}
+
+func (e *ContentTypeMismatchError) Error() string {
+	received := e.Received
+	if received == "" {
+		received = "none"
+	}
+	return ErrContentTypeMismatch.Error() + ": got " + received + ", want " + strings.Join(e.Expected, ", ")
+}
+
+func (e *ContentTypeMismatchError) Is(target error) bool {
+	return target == ErrContentTypeMismatch
+}
+
+// ContentNegotiationMiddleware returns a Middleware which sets the Accept
+// header field of requests (which don't already have one) to the media types
+// in accepted, and fails round-trips with a *ContentTypeMismatchError when
+// the response's Content-Type isn't one of them. Accepted types may use
+// wildcards, such as "text/*" or "*/*". Responses without a body aren't
+// checked.
+func ContentNegotiationMiddleware(accepted []string) Middleware {
+	header := strings.Join(accepted, ", ")
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if !req.Fields.Has("Accept") {
+			req.Fields.Set("Accept", header)
+		}
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil || resp.Body == nil {
+			return resp, err
+		}
+
+		v, _ := resp.Fields.Get("Content-Type")
+		if mt, _, err := mime.ParseMediaType(v); err == nil && acceptsType(accepted, mt) {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		return nil, &ContentTypeMismatchError{
+			Expected: accepted,
+			Received: v,
+		}
+	}
+}
+
+// acceptsType reports whether the media type mt matches any of accepted.
+func acceptsType(accepted []string, mt string) bool {
+	for _, a := range accepted {
+		// Ignore any parameters (such as quality values).
+		if i := strings.IndexByte(a, ';'); i >= 0 {
+			a = a[:i]
+		}
+		a = strings.ToLower(strings.TrimSpace(a))
+
+		switch {
+		case a == "*/*" || a == mt:
+			return true
+		case strings.HasSuffix(a, "/*") && strings.HasPrefix(mt, a[:len(a)-1]):
+			return true
+		}
+	}
+
+	return false
+}
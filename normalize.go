@@ -0,0 +1,73 @@
+package wire
+
+import (
+	"context"
+	"net/textproto"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// Layout used for HTTP date header fields (as per RFC 7231, section 7.1.1.1).
+const timeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// NormalizationRules configures HeaderNormalizerMiddleware.
+type NormalizationRules struct {
+	// StripHopByHop removes hop-by-hop header fields, including any listed
+	// in the Connection header. Transfer-Encoding is left intact because it
+	// determines how the request body is framed.
+	StripHopByHop bool
+
+	// DefaultUserAgent, if not empty, is used as the User-Agent header for
+	// requests which don't already have one.
+	DefaultUserAgent string
+
+	// AddDate adds a Date header to requests which don't already have one.
+	AddDate bool
+
+	// DenyList contains the names of header fields which should always be
+	// removed.
+	DenyList []string
+
+	// AddHeaders contains header fields which are added to requests that
+	// don't already have a field with the same name.
+	AddHeaders heat.Fields
+}
+
+// HeaderNormalizerMiddleware returns a Middleware which normalizes request
+// header fields according to rules. Field names are always canonicalized
+// (e.g. "content-type" becomes "Content-Type"), and a Host header is added if
+// one is missing.
+func HeaderNormalizerMiddleware(rules NormalizationRules) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		for i := range req.Fields {
+			req.Fields[i].Name = textproto.CanonicalMIMEHeaderKey(req.Fields[i].Name)
+		}
+
+		if rules.StripHopByHop {
+			stripHopByHop(&req.Fields, "Transfer-Encoding")
+		}
+
+		for _, name := range rules.DenyList {
+			req.Fields.Del(name)
+		}
+
+		if !req.Fields.Has("Host") {
+			req.Fields.Set("Host", req.Remote)
+		}
+		if rules.DefaultUserAgent != "" && !req.Fields.Has("User-Agent") {
+			req.Fields.Set("User-Agent", rules.DefaultUserAgent)
+		}
+		if rules.AddDate && !req.Fields.Has("Date") {
+			req.Fields.Set("Date", time.Now().UTC().Format(timeFormat))
+		}
+
+		for _, f := range rules.AddHeaders {
+			if !req.Fields.Has(f.Name) {
+				req.Fields.Add(f.Name, f.Value)
+			}
+		}
+
+		return next.RoundTrip(ctx, req)
+	}
+}
@@ -0,0 +1,131 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/erkl/heat"
+	"golang.org/x/oauth2"
+)
+
+var ErrNoToken = errors.New("token source returned no token")
+
+// OAuth2Middleware returns a Middleware which authorizes requests with
+// access tokens obtained from src, for requests which don't already have an
+// Authorization header. Wrapping src with oauth2.ReuseTokenSource avoids
+// fetching a new token for every request. Round-trips fail with ErrNoToken if
+// src returns neither a token nor an error.
+//
+// Tokens are bound to the scheme and host of the first request authorized,
+// and never sent anywhere else, so they don't leak to the targets of
+// redirects. Requests to other hosts are passed on as-is.
+//
+// If the server responds with 401 (Unauthorized), a new token is obtained
+// and the request is retried once. Sources with a method
+// "Refresh() (*oauth2.Token, error)" are asked for a fresh token using that
+// method; otherwise Token is called again, and the request is only retried if
+// it yields a different token.
+//
+// The Authorization header is added to a copy of the request. Request bodies
+// are buffered in memory so that they can be sent again.
+func OAuth2Middleware(src oauth2.TokenSource) Middleware {
+	// The origin tokens are bound to.
+	var mu sync.Mutex
+	var bound string
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if req.Fields.Has("Authorization") {
+			return next.RoundTrip(ctx, req)
+		}
+
+		origin := requestOrigin(req)
+
+		mu.Lock()
+		if bound == "" {
+			bound = origin
+		}
+		same := bound == origin
+		mu.Unlock()
+
+		if !same {
+			return next.RoundTrip(ctx, req)
+		}
+
+		// Buffer the request body, so it can be replayed.
+		var buf []byte
+		if req.Body != nil {
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			buf = b
+		}
+
+		tok, err := src.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			return nil, ErrNoToken
+		}
+
+		resp, err := next.RoundTrip(ctx, authorized(req, tok, buf))
+		if err != nil || resp.Status != 401 {
+			return resp, err
+		}
+
+		// Get a new token, and retry if we got one.
+		var fresh *oauth2.Token
+		if r, ok := src.(interface {
+			Refresh() (*oauth2.Token, error)
+		}); ok {
+			fresh, err = r.Refresh()
+		} else {
+			fresh, err = src.Token()
+		}
+
+		if err != nil || fresh == nil || fresh.AccessToken == tok.AccessToken {
+			return resp, nil
+		}
+
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+
+		return next.RoundTrip(ctx, authorized(req, fresh, buf))
+	}
+}
+
+// authorized returns a copy of req authorized with tok, with buf (if req has
+// a body) as its body.
+func authorized(req *heat.Request, tok *oauth2.Token, buf []byte) *heat.Request {
+	dup := *req
+	dup.Fields = append(heat.Fields(nil), req.Fields...)
+	dup.Fields.Set("Authorization", tokenAuth(tok))
+
+	if req.Body != nil {
+		dup.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	}
+
+	return &dup
+}
+
+// requestOrigin returns the normalized scheme and host req is sent to.
+func requestOrigin(req *heat.Request) string {
+	port := "80"
+	if strings.EqualFold(req.Scheme, "https") {
+		port = "443"
+	}
+
+	return strings.ToLower(req.Scheme + "://" + defaultPort(req.Remote, port))
+}
+
+// tokenAuth returns the Authorization header value for tok.
+func tokenAuth(tok *oauth2.Token) string {
+	return tok.Type() + " " + tok.AccessToken
+}
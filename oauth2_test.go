@@ -0,0 +1,94 @@
+package wire
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erkl/heat"
+	"golang.org/x/oauth2"
+)
+
+// refreshSource hands out a new token every time it's refreshed.
+type refreshSource struct {
+	tokens []string
+}
+
+func (s *refreshSource) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: s.tokens[0], TokenType: "Bearer"}, nil
+}
+
+func (s *refreshSource) Refresh() (*oauth2.Token, error) {
+	s.tokens = s.tokens[1:]
+	return s.Token()
+}
+
+func TestOAuth2Retry(t *testing.T) {
+	mw := OAuth2Middleware(&refreshSource{tokens: []string{"a", "b", "c"}})
+
+	var sent []string
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		auth, _ := req.Fields.Get("Authorization")
+		sent = append(sent, auth)
+		return &heat.Response{Status: 401}, nil
+	})
+
+	req := &heat.Request{Method: "GET", Scheme: "https", Remote: "api.example.com", URI: "/"}
+
+	// Send the request twice, as RetryMiddleware would.
+	for i := 0; i < 2; i++ {
+		if _, err := mw(context.Background(), req, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"Bearer a", "Bearer b", "Bearer b", "Bearer c"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %q, want %q", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("sent %q, want %q", sent, want)
+		}
+	}
+	if req.Fields.Has("Authorization") {
+		t.Error("caller's request was modified")
+	}
+}
+
+func TestOAuth2OtherHost(t *testing.T) {
+	mw := OAuth2Middleware(&refreshSource{tokens: []string{"a"}})
+
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		if requestOrigin(req) != "https://api.example.com:443" && req.Fields.Has("Authorization") {
+			t.Errorf("token sent to %s://%s", req.Scheme, req.Remote)
+		}
+		return &heat.Response{Status: 200}, nil
+	})
+
+	for _, remote := range []string{"api.example.com:443", "API.example.com", "evil.example.com"} {
+		req := &heat.Request{Method: "GET", Scheme: "https", Remote: remote, URI: "/"}
+		if _, err := mw(context.Background(), req, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := &heat.Request{Method: "GET", Scheme: "http", Remote: "api.example.com", URI: "/"}
+	if _, err := mw(context.Background(), req, next); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type nilSource struct{}
+
+func (nilSource) Token() (*oauth2.Token, error) {
+	return nil, nil
+}
+
+func TestOAuth2NilToken(t *testing.T) {
+	mw := OAuth2Middleware(nilSource{})
+
+	req := &heat.Request{Method: "GET", Scheme: "https", Remote: "api.example.com", URI: "/"}
+	if _, err := mw(context.Background(), req, notImplemented); err != ErrNoToken {
+		t.Fatalf("round-trip returned %v, want %v", err, ErrNoToken)
+	}
+}
@@ -0,0 +1,835 @@
+package wire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/erkl/heat"
+)
+
+var ErrInvalidSpec = errors.New("invalid OpenAPI spec")
+
+// A ValidationError is returned by OpenAPIValidatorMiddleware when a response
+// doesn't conform to the API specification.
+type ValidationError struct {
+	Method string
+	Path   string
+	Status int
+
+	// Violations describes each way in which the response deviates from
+	// the specification, e.g. "$.items[0].id: expected integer, got string".
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("response to %s %s (status %d) violates API spec: %s",
+		e.Method, e.Path, e.Status, strings.Join(e.Violations, "; "))
+}
+
+// OpenAPIValidatorMiddleware returns a Middleware which validates responses
+// against spec, a JSON-encoded OpenAPI 3.x specification. Responses to
+// requests matching one of the spec's operations must have a documented
+// status code and media type, and JSON bodies must conform to the
+// corresponding schema. If not, the round-trip fails with a *ValidationError.
+// Responses to other requests are passed on as is.
+//
+// Response bodies which are validated are read into memory (up to
+// DefaultMaxBodySize bytes) and replaced with equivalent readers.
+//
+// The spec is parsed, and each operation's response schemas compiled, once.
+// Local references ("$ref") are supported, as are most JSON Schema keywords
+// describing types, enums, objects, arrays, strings and numbers, and schema
+// composition. Other keywords (such as "format") are ignored.
+func OpenAPIValidatorMiddleware(spec []byte) (Middleware, error) {
+	v, err := newAPIValidator(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		path := requestPath(req.URI)
+
+		op := v.match(req.Method, path)
+		if op == nil {
+			return resp, nil
+		}
+
+		violations, err := op.validate(resp)
+		if err != nil {
+			return nil, err
+		}
+		if len(violations) == 0 {
+			return resp, nil
+		}
+
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+
+		return nil, &ValidationError{
+			Method:     req.Method,
+			Path:       path,
+			Status:     resp.Status,
+			Violations: violations,
+		}
+	}, nil
+}
+
+// requestPath returns the path of a request URI, without the query, and
+// without the scheme and authority of absolute-form URIs (as sent to proxies).
+func requestPath(uri string) string {
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		uri = uri[:i]
+	}
+
+	if i := strings.Index(uri, "://"); i >= 0 && !strings.HasPrefix(uri, "/") {
+		uri = uri[i+3:]
+		if i = strings.IndexByte(uri, '/'); i < 0 {
+			return "/"
+		}
+		uri = uri[i:]
+	}
+
+	return uri
+}
+
+// An apiValidator holds the operations described by an OpenAPI spec.
+type apiValidator struct {
+	ops []*apiOperation
+
+	// Path prefixes of the spec's servers, such as "/v1".
+	bases []string
+}
+
+type apiOperation struct {
+	method string
+
+	// Path template, such as "/users/{id}", compiled into a regexp.
+	path   *regexp.Regexp
+	params int
+
+	// Responses, keyed by status code ("200"), range ("2XX") or "default".
+	responses map[string]*apiResponse
+}
+
+type apiResponse struct {
+	// Body schemas, keyed by media type (range). A nil schema accepts any
+	// body.
+	content map[string]*schema
+}
+
+var apiMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+func newAPIValidator(spec []byte) (*apiValidator, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, ErrInvalidSpec
+	}
+
+	c := &schemaCompiler{doc: doc, refs: make(map[string]*schema)}
+	v := new(apiValidator)
+
+	// Collect the path prefixes of the spec's servers.
+	servers, _ := doc["servers"].([]interface{})
+	for _, s := range servers {
+		if base := serverBase(s); base != "" {
+			v.bases = append(v.bases, base)
+		}
+	}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	for _, tmpl := range sortedKeys(paths) {
+		item, err := c.deref(paths[tmpl])
+		if err != nil {
+			return nil, err
+		}
+
+		re, params, err := compilePathTemplate(tmpl)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, method := range apiMethods {
+			node, ok := item[method]
+			if !ok {
+				continue
+			}
+
+			op, err := c.operation(node)
+			if err != nil {
+				return nil, err
+			}
+
+			op.method = strings.ToUpper(method)
+			op.path = re
+			op.params = params
+
+			v.ops = append(v.ops, op)
+		}
+	}
+
+	return v, nil
+}
+
+// serverBase returns the path of a server object's URL, with variables
+// replaced by their default values, and without a trailing slash.
+func serverBase(node interface{}) string {
+	server, _ := node.(map[string]interface{})
+	raw, _ := server["url"].(string)
+
+	vars, _ := server["variables"].(map[string]interface{})
+	for name, v := range vars {
+		v, _ := v.(map[string]interface{})
+		def, _ := v["default"].(string)
+		raw = strings.Replace(raw, "{"+name+"}", def, -1)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimRight(u.Path, "/")
+}
+
+// compilePathTemplate compiles a path template into a regexp, returning it
+// along with the number of parameters in the template.
+func compilePathTemplate(tmpl string) (*regexp.Regexp, int, error) {
+	var expr strings.Builder
+	var params int
+
+	expr.WriteByte('^')
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			return nil, 0, ErrInvalidSpec
+		}
+
+		expr.WriteString(regexp.QuoteMeta(tmpl[:i]))
+		expr.WriteString("[^/]+")
+		tmpl = tmpl[i+j+1:]
+		params++
+	}
+	expr.WriteString(regexp.QuoteMeta(tmpl))
+	expr.WriteByte('$')
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, 0, ErrInvalidSpec
+	}
+
+	return re, params, nil
+}
+
+// match returns the operation matching method and path, or nil. Paths are
+// matched with and without the spec's server path prefixes; when several
+// templates match, the one with the fewest parameters wins.
+func (v *apiValidator) match(method, path string) *apiOperation {
+	paths := []string{path}
+	for _, base := range v.bases {
+		if strings.HasPrefix(path, base+"/") {
+			paths = append(paths, path[len(base):])
+		}
+	}
+
+	for _, p := range paths {
+		var best *apiOperation
+		for _, op := range v.ops {
+			if op.method != method || !op.path.MatchString(p) {
+				continue
+			}
+			if best == nil || op.params < best.params {
+				best = op
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+
+	return nil
+}
+
+// validate checks resp against the operation, returning any violations. If
+// the response body is validated, it's replaced with an in-memory copy.
+func (op *apiOperation) validate(resp *heat.Response) ([]string, error) {
+	r := op.responses[strconv.Itoa(resp.Status)]
+	if r == nil {
+		r = op.responses[strconv.Itoa(resp.Status/100)+"XX"]
+	}
+	if r == nil {
+		r = op.responses["default"]
+	}
+	if r == nil {
+		return []string{fmt.Sprintf("status %d is not documented", resp.Status)}, nil
+	}
+
+	if resp.Body == nil || len(r.content) == 0 {
+		return nil, nil
+	}
+
+	v, _ := resp.Fields.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		return []string{fmt.Sprintf("content type %q is not documented", v)}, nil
+	}
+
+	s, ok := r.content[mt]
+	if !ok {
+		s, ok = r.content[mt[:strings.IndexByte(mt, '/')+1]+"*"]
+	}
+	if !ok {
+		s, ok = r.content["*/*"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("content type %q is not documented", mt)}, nil
+	}
+
+	if s == nil || !isJSON(resp.Fields) {
+		return nil, nil
+	}
+
+	data, err := ReadResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = newBytesBody(data)
+
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return []string{"invalid JSON body: " + err.Error()}, nil
+	}
+
+	var violations []string
+	s.validate(body, "$", &violations)
+
+	return violations, nil
+}
+
+// A schemaCompiler compiles the schemas found in an OpenAPI document.
+type schemaCompiler struct {
+	doc map[string]interface{}
+
+	// Schemas compiled from references, by reference. Entries are added
+	// before the referenced schema is compiled, to allow for cycles.
+	refs map[string]*schema
+}
+
+func (c *schemaCompiler) operation(node interface{}) (*apiOperation, error) {
+	m, err := c.deref(node)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &apiOperation{responses: make(map[string]*apiResponse)}
+
+	responses, _ := m["responses"].(map[string]interface{})
+	for code, node := range responses {
+		m, err := c.deref(node)
+		if err != nil {
+			return nil, err
+		}
+
+		r := &apiResponse{content: make(map[string]*schema)}
+
+		content, _ := m["content"].(map[string]interface{})
+		for mt, node := range content {
+			media, err := c.deref(node)
+			if err != nil {
+				return nil, err
+			}
+
+			if mt, _, err = mime.ParseMediaType(mt); err != nil {
+				return nil, ErrInvalidSpec
+			}
+
+			var s *schema
+			if node, ok := media["schema"]; ok {
+				if s, err = c.compile(node); err != nil {
+					return nil, err
+				}
+			}
+
+			r.content[mt] = s
+		}
+
+		op.responses[strings.ToUpper(code)] = r
+	}
+
+	return op, nil
+}
+
+// deref returns the object node, following references.
+func (c *schemaCompiler) deref(node interface{}) (map[string]interface{}, error) {
+	for depth := 0; depth < 32; depth++ {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, ErrInvalidSpec
+		}
+
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m, nil
+		}
+
+		var err error
+		if node, err = c.lookup(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrInvalidSpec
+}
+
+// lookup resolves a local reference, such as "#/components/schemas/User".
+func (c *schemaCompiler) lookup(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, ErrInvalidSpec
+	}
+
+	var node interface{} = c.doc
+	for _, token := range strings.Split(ref[2:], "/") {
+		token, err := url.PathUnescape(token)
+		if err != nil {
+			return nil, ErrInvalidSpec
+		}
+		token = strings.Replace(token, "~1", "/", -1)
+		token = strings.Replace(token, "~0", "~", -1)
+
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, ErrInvalidSpec
+		}
+		if node, ok = m[token]; !ok {
+			return nil, ErrInvalidSpec
+		}
+	}
+
+	return node, nil
+}
+
+// A schema is a compiled JSON Schema (as used by OpenAPI). Unset numeric
+// limits are negative or nil.
+type schema struct {
+	// True for the schema "false", which rejects everything.
+	reject bool
+
+	types    []string
+	nullable bool
+	enum     []interface{}
+
+	// Objects.
+	properties    map[string]*schema
+	names         []string
+	required      []string
+	additional    *schema
+	minProperties int
+	maxProperties int
+
+	// Arrays.
+	items    *schema
+	minItems int
+	maxItems int
+
+	// Strings.
+	minLength int
+	maxLength int
+	pattern   *regexp.Regexp
+
+	// Numbers.
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         float64
+
+	// Composition.
+	allOf, anyOf, oneOf []*schema
+	not                 *schema
+}
+
+func (c *schemaCompiler) compile(node interface{}) (*schema, error) {
+	if b, ok := node.(bool); ok {
+		return &schema{reject: !b}, nil
+	}
+
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidSpec
+	}
+
+	if ref, ok := m["$ref"].(string); ok {
+		if s := c.refs[ref]; s != nil {
+			return s, nil
+		}
+
+		target, err := c.lookup(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		// Pure reference cycles (which constrain nothing) end up with
+		// this placeholder, so it must accept anything.
+		s := &schema{
+			minProperties: -1,
+			maxProperties: -1,
+			minItems:      -1,
+			maxItems:      -1,
+			minLength:     -1,
+			maxLength:     -1,
+		}
+		c.refs[ref] = s
+
+		t, err := c.compile(target)
+		if err != nil {
+			return nil, err
+		}
+
+		*s = *t
+		return s, nil
+	}
+
+	s := &schema{
+		minProperties: intKeyword(m, "minProperties"),
+		maxProperties: intKeyword(m, "maxProperties"),
+		minItems:      intKeyword(m, "minItems"),
+		maxItems:      intKeyword(m, "maxItems"),
+		minLength:     intKeyword(m, "minLength"),
+		maxLength:     intKeyword(m, "maxLength"),
+	}
+
+	switch t := m["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, t := range t {
+			if t, ok := t.(string); ok {
+				s.types = append(s.types, t)
+			}
+		}
+	}
+
+	s.nullable, _ = m["nullable"].(bool)
+	s.enum, _ = m["enum"].([]interface{})
+	s.required = stringList(m["required"])
+
+	var err error
+
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		s.properties = make(map[string]*schema, len(props))
+		s.names = sortedKeys(props)
+		for name, node := range props {
+			if s.properties[name], err = c.compile(node); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if node, ok := m["additionalProperties"]; ok {
+		if s.additional, err = c.compile(node); err != nil {
+			return nil, err
+		}
+	}
+
+	if node, ok := m["items"]; ok {
+		if s.items, err = c.compile(node); err != nil {
+			return nil, err
+		}
+	}
+
+	if p, ok := m["pattern"].(string); ok {
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			return nil, ErrInvalidSpec
+		}
+	}
+
+	s.minimum = floatKeyword(m, "minimum")
+	s.maximum = floatKeyword(m, "maximum")
+	s.multipleOf, _ = m["multipleOf"].(float64)
+
+	// OpenAPI 3.0 uses booleans to make minimum and maximum exclusive,
+	// whereas 3.1 (like JSON Schema) uses separate numeric limits.
+	if m["exclusiveMinimum"] == true {
+		s.minimum, s.exclusiveMinimum = nil, s.minimum
+	} else {
+		s.exclusiveMinimum = floatKeyword(m, "exclusiveMinimum")
+	}
+	if m["exclusiveMaximum"] == true {
+		s.maximum, s.exclusiveMaximum = nil, s.maximum
+	} else {
+		s.exclusiveMaximum = floatKeyword(m, "exclusiveMaximum")
+	}
+
+	for _, kw := range []struct {
+		name string
+		list *[]*schema
+	}{
+		{"allOf", &s.allOf},
+		{"anyOf", &s.anyOf},
+		{"oneOf", &s.oneOf},
+	} {
+		nodes, _ := m[kw.name].([]interface{})
+		for _, node := range nodes {
+			sub, err := c.compile(node)
+			if err != nil {
+				return nil, err
+			}
+			*kw.list = append(*kw.list, sub)
+		}
+	}
+
+	if node, ok := m["not"]; ok {
+		if s.not, err = c.compile(node); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// validate checks the JSON value v (found at path) against the schema,
+// appending any violations.
+func (s *schema) validate(v interface{}, path string, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.reject {
+		fail("no value is allowed")
+		return
+	}
+
+	if v == nil && s.nullable {
+		return
+	}
+
+	if len(s.types) > 0 && !s.hasType(v) {
+		fail("expected %s, got %s", strings.Join(s.types, " or "), jsonType(v))
+		return
+	}
+
+	if len(s.enum) > 0 && !containsValue(s.enum, v) {
+		fail("value is not one of the allowed values")
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for _, name := range s.names {
+			if x, ok := v[name]; ok {
+				s.properties[name].validate(x, propertyPath(path, name), violations)
+			}
+		}
+		if s.additional != nil {
+			for _, name := range sortedKeys(v) {
+				if _, ok := s.properties[name]; !ok {
+					if s.additional.reject {
+						fail("unexpected property %q", name)
+					} else {
+						s.additional.validate(v[name], propertyPath(path, name), violations)
+					}
+				}
+			}
+		}
+		if s.minProperties >= 0 && len(v) < s.minProperties {
+			fail("expected at least %d properties, got %d", s.minProperties, len(v))
+		}
+		if s.maxProperties >= 0 && len(v) > s.maxProperties {
+			fail("expected at most %d properties, got %d", s.maxProperties, len(v))
+		}
+
+	case []interface{}:
+		if s.items != nil {
+			for i, x := range v {
+				s.items.validate(x, path+"["+strconv.Itoa(i)+"]", violations)
+			}
+		}
+		if s.minItems >= 0 && len(v) < s.minItems {
+			fail("expected at least %d items, got %d", s.minItems, len(v))
+		}
+		if s.maxItems >= 0 && len(v) > s.maxItems {
+			fail("expected at most %d items, got %d", s.maxItems, len(v))
+		}
+
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength >= 0 && n < s.minLength {
+			fail("expected at least %d characters, got %d", s.minLength, n)
+		}
+		if s.maxLength >= 0 && n > s.maxLength {
+			fail("expected at most %d characters, got %d", s.maxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("value does not match pattern %q", s.pattern.String())
+		}
+
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("value %v is less than %v", v, *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			fail("value %v is greater than %v", v, *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			fail("value %v is not greater than %v", v, *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			fail("value %v is not less than %v", v, *s.exclusiveMaximum)
+		}
+		if s.multipleOf > 0 {
+			if q := v / s.multipleOf; q != math.Trunc(q) {
+				fail("value %v is not a multiple of %v", v, s.multipleOf)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, violations)
+	}
+
+	if len(s.anyOf) > 0 && countMatches(s.anyOf, v) == 0 {
+		fail("value does not match any schema in anyOf")
+	}
+
+	if len(s.oneOf) > 0 {
+		if n := countMatches(s.oneOf, v); n != 1 {
+			fail("value matches %d schemas in oneOf, expected exactly 1", n)
+		}
+	}
+
+	if s.not != nil && s.not.matches(v) {
+		fail("value matches schema in not")
+	}
+}
+
+// matches reports whether v conforms to the schema.
+func (s *schema) matches(v interface{}) bool {
+	var violations []string
+	s.validate(v, "", &violations)
+	return len(violations) == 0
+}
+
+// countMatches returns the number of schemas v conforms to.
+func countMatches(schemas []*schema, v interface{}) int {
+	var n int
+	for _, sub := range schemas {
+		if sub.matches(v) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *schema) hasType(v interface{}) bool {
+	jt := jsonType(v)
+	for _, t := range s.types {
+		if t == jt || t == "number" && jt == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type name of a value decoded by
+// encoding/json. Whole numbers are considered integers.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, x := range values {
+		if reflect.DeepEqual(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// propertyPath returns the path of the property name of the object at path.
+func propertyPath(path, name string) string {
+	for _, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return path + "[" + strconv.Quote(name) + "]"
+		}
+	}
+	if name == "" {
+		return path + `[""]`
+	}
+	return path + "." + name
+}
+
+func intKeyword(m map[string]interface{}, name string) int {
+	if f, ok := m[name].(float64); ok && f >= 0 {
+		return int(f)
+	}
+	return -1
+}
+
+func floatKeyword(m map[string]interface{}, name string) *float64 {
+	if f, ok := m[name].(float64); ok {
+		return &f
+	}
+	return nil
+}
+
+func stringList(node interface{}) []string {
+	var list []string
+	nodes, _ := node.([]interface{})
+	for _, x := range nodes {
+		if s, ok := x.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
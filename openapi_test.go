@@ -0,0 +1,173 @@
+package wire
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+const testSpec = `{
+	"openapi": "3.1.0",
+	"servers": [
+		{"url": "https://api.example.com/{version}", "variables": {"version": {"default": "v1"}}}
+	],
+	"paths": {
+		"/users/{id}": {"get": {"responses": {
+			"200": {"content": {
+				"application/*": {"schema": {"$ref": "#/components/schemas/User"}},
+				"*/*": {}
+			}},
+			"4XX": {"content": {
+				"application/json": {"schema": {"type": "object", "required": ["error"]}}
+			}}
+		}}},
+		"/nodes": {"get": {"responses": {"200": {"content": {
+			"application/json": {"schema": {"$ref": "#/components/schemas/Node"}}
+		}}}}},
+		"/loop": {"get": {"responses": {"200": {"content": {
+			"application/json": {"schema": {"$ref": "#/components/schemas/Loop"}}
+		}}}}},
+		"/numbers": {"get": {"responses": {"200": {"content": {
+			"application/json": {"schema": {"$ref": "#/components/schemas/Numbers"}}
+		}}}}},
+		"/shapes": {"get": {"responses": {"200": {"content": {
+			"application/json": {"schema": {"$ref": "#/components/schemas/Shape"}}
+		}}}}}
+	},
+	"components": {"schemas": {
+		"User": {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}},
+		"Node": {"type": "object", "properties": {
+			"value": {"type": "integer"},
+			"next": {"$ref": "#/components/schemas/Node"}
+		}},
+		"Loop": {"$ref": "#/components/schemas/Loop2"},
+		"Loop2": {"$ref": "#/components/schemas/Loop"},
+		"Numbers": {"type": "object", "properties": {
+			"legacy": {"type": "number", "minimum": 0, "exclusiveMinimum": true, "maximum": 10, "exclusiveMaximum": true},
+			"modern": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 10}
+		}},
+		"Shape": {"type": "object", "properties": {
+			"one": {"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 5}]},
+			"any": {"anyOf": [{"type": "string"}, {"type": "boolean"}]},
+			"not": {"not": {"type": "null"}}
+		}}
+	}}
+}`
+
+func TestOpenAPIValidator(t *testing.T) {
+	mw, err := OpenAPIValidatorMiddleware([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uri    string
+		status int
+		ctype  string
+		body   string
+
+		// Substrings of the expected violations, if any.
+		want []string
+	}{
+		// Server base paths, and absolute-form URIs.
+		{"/v1/users/1", 200, "application/json", `{"id": 1}`, nil},
+		{"/v1/users/1", 200, "application/json", `{"id": "1"}`, []string{"$.id: expected integer"}},
+		{"/users/1", 200, "application/json", `{}`, []string{`missing required property "id"`}},
+		{"/v2/users/1", 200, "application/json", `{}`, nil},
+		{"http://api.example.com/v1/users/1?x=1", 200, "application/json", `{}`, []string{`missing required property "id"`}},
+
+		// Media type ranges.
+		{"/v1/users/1", 200, "application/problem+json; charset=utf-8", `{"id": true}`, []string{"$.id: expected integer"}},
+		{"/v1/users/1", 200, "text/plain", `anything`, nil},
+
+		// Status codes.
+		{"/v1/users/1", 404, "application/json", `{"error": "not found"}`, nil},
+		{"/v1/users/1", 404, "application/json", `{}`, []string{`missing required property "error"`}},
+		{"/nodes", 500, "application/json", `{}`, []string{"status 500 is not documented"}},
+
+		// Reference cycles.
+		{"/nodes", 200, "application/json", `{"value": 1, "next": {"next": {"value": 3}}}`, nil},
+		{"/nodes", 200, "application/json", `{"next": {"next": {"value": "3"}}}`, []string{"$.next.next.value: expected integer"}},
+		{"/loop", 200, "application/json", `[1, "two"]`, nil},
+
+		// OpenAPI 3.0 (boolean) and 3.1 (numeric) exclusive limits.
+		{"/numbers", 200, "application/json", `{"legacy": 5, "modern": 5}`, nil},
+		{"/numbers", 200, "application/json", `{"legacy": 0}`, []string{"$.legacy: value 0 is not greater than 0"}},
+		{"/numbers", 200, "application/json", `{"legacy": 10}`, []string{"$.legacy: value 10 is not less than 10"}},
+		{"/numbers", 200, "application/json", `{"modern": 0}`, []string{"$.modern: value 0 is not greater than 0"}},
+		{"/numbers", 200, "application/json", `{"modern": 10}`, []string{"$.modern: value 10 is not less than 10"}},
+
+		// Composition.
+		{"/shapes", 200, "application/json", `{"one": 3, "any": "x", "not": 1}`, nil},
+		{"/shapes", 200, "application/json", `{"one": 5.5, "any": true}`, nil},
+		{"/shapes", 200, "application/json", `{"one": 7}`, []string{"$.one: value matches 2 schemas in oneOf"}},
+		{"/shapes", 200, "application/json", `{"one": "x"}`, []string{"$.one: value matches 0 schemas in oneOf"}},
+		{"/shapes", 200, "application/json", `{"any": 1}`, []string{"$.any: value does not match any schema in anyOf"}},
+		{"/shapes", 200, "application/json", `{"not": null}`, []string{"$.not: value matches schema in not"}},
+	}
+
+	for _, tt := range tests {
+		next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+			resp := &heat.Response{Status: tt.status}
+			resp.Fields.Set("Content-Type", tt.ctype)
+			resp.Fields.Set("Content-Length", strconv.Itoa(len(tt.body)))
+			return withBody(resp, []byte(tt.body)), nil
+		})
+
+		req := &heat.Request{Method: "GET", Scheme: "https", Remote: "api.example.com", URI: tt.uri}
+		_, err := mw(context.Background(), req, next)
+
+		var violations []string
+		if verr, ok := err.(*ValidationError); ok {
+			violations = verr.Violations
+		} else if err != nil {
+			t.Errorf("GET %s: unexpected error %v", tt.uri, err)
+			continue
+		}
+
+		if len(violations) != len(tt.want) {
+			t.Errorf("GET %s (%d %s): got violations %q, want %q", tt.uri, tt.status, tt.body, violations, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if !strings.Contains(violations[i], tt.want[i]) {
+				t.Errorf("GET %s (%d %s): got violations %q, want %q", tt.uri, tt.status, tt.body, violations, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestOpenAPIInvalidSpec(t *testing.T) {
+	specs := []string{
+		`{"swagger": "2.0"}`,
+		`{"openapi": "3.0.0", "paths": {"/a": {"$ref": "#/paths/~1b"}, "/b": {"$ref": "#/paths/~1a"}}}`,
+		`{"openapi": "3.0.0", "paths": {"/a": {"get": {"responses": {"200": {"$ref": "#/missing"}}}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/{a": {"get": {"responses": {}}}}}`,
+	}
+
+	for _, spec := range specs {
+		if _, err := OpenAPIValidatorMiddleware([]byte(spec)); err != ErrInvalidSpec {
+			t.Errorf("OpenAPIValidatorMiddleware(%s) returned %v, want %v", spec, err, ErrInvalidSpec)
+		}
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	tests := map[string]string{
+		"/users/1":                       "/users/1",
+		"/users/1?next=http://x/y":       "/users/1",
+		"http://example.com/users/1?x=1": "/users/1",
+		"https://example.com":            "/",
+		"https://example.com?x=1":        "/",
+	}
+
+	for uri, want := range tests {
+		if got := requestPath(uri); got != want {
+			t.Errorf("requestPath(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
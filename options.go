@@ -0,0 +1,139 @@
+package wire
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// A TransportOption configures a Transport created by NewTransport.
+type TransportOption func(*Transport)
+
+// NewTransport returns a new Transport configured by opts. Fields not set by
+// any option keep their zero values (which are documented on the Transport
+// type).
+//
+//	t := wire.NewTransport(
+//		wire.WithKeepAliveTimeout(30*time.Second),
+//		wire.WithMaxIdleConnsPerHost(8),
+//	)
+func NewTransport(opts ...TransportOption) *Transport {
+	t := new(Transport)
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// WithDial sets Transport.Dial.
+func WithDial(dial func(addr string) (net.Conn, error)) TransportOption {
+	return func(t *Transport) { t.Dial = dial }
+}
+
+// WithDialTLS sets Transport.DialTLS.
+func WithDialTLS(dial func(addr string) (net.Conn, error)) TransportOption {
+	return func(t *Transport) { t.DialTLS = dial }
+}
+
+// WithDialTimeout sets Transport.DialTimeout.
+func WithDialTimeout(d time.Duration) TransportOption {
+	return func(t *Transport) { t.DialTimeout = d }
+}
+
+// WithDNSCacheTTL sets Transport.DNSCacheTTL.
+func WithDNSCacheTTL(d time.Duration) TransportOption {
+	return func(t *Transport) { t.DNSCacheTTL = d }
+}
+
+// WithPreferNetwork sets Transport.PreferNetwork.
+func WithPreferNetwork(network string) TransportOption {
+	return func(t *Transport) { t.PreferNetwork = network }
+}
+
+// WithDisableKeepAlives sets Transport.DisableKeepAlives.
+func WithDisableKeepAlives(disable bool) TransportOption {
+	return func(t *Transport) { t.DisableKeepAlives = disable }
+}
+
+// WithForceAttemptHTTP2 sets Transport.ForceAttemptHTTP2.
+func WithForceAttemptHTTP2(force bool) TransportOption {
+	return func(t *Transport) { t.ForceAttemptHTTP2 = force }
+}
+
+// WithLocalAddr sets Transport.LocalAddr.
+func WithLocalAddr(addr net.Addr) TransportOption {
+	return func(t *Transport) { t.LocalAddr = addr }
+}
+
+// WithDisableTCPNoDelay sets Transport.DisableTCPNoDelay.
+func WithDisableTCPNoDelay(disable bool) TransportOption {
+	return func(t *Transport) { t.DisableTCPNoDelay = disable }
+}
+
+// WithKeepAliveTimeout sets Transport.KeepAliveTimeout.
+func WithKeepAliveTimeout(d time.Duration) TransportOption {
+	return func(t *Transport) { t.KeepAliveTimeout = d }
+}
+
+// WithKeepAliveCheckInterval sets Transport.KeepAliveCheckInterval.
+func WithKeepAliveCheckInterval(d time.Duration) TransportOption {
+	return func(t *Transport) { t.KeepAliveCheckInterval = d }
+}
+
+// WithMaxIdleConnsPerHost sets Transport.MaxIdleConnsPerHost.
+func WithMaxIdleConnsPerHost(n int) TransportOption {
+	return func(t *Transport) { t.MaxIdleConnsPerHost = n }
+}
+
+// WithMaxIdleConns sets Transport.MaxIdleConns.
+func WithMaxIdleConns(n int) TransportOption {
+	return func(t *Transport) { t.MaxIdleConns = n }
+}
+
+// WithMaxConnsPerHost sets Transport.MaxConnsPerHost.
+func WithMaxConnsPerHost(n int) TransportOption {
+	return func(t *Transport) { t.MaxConnsPerHost = n }
+}
+
+// WithProxyURL sets Transport.ProxyURL.
+func WithProxyURL(url string) TransportOption {
+	return func(t *Transport) { t.ProxyURL = url }
+}
+
+// WithTLSClientConfig sets Transport.TLSClientConfig.
+func WithTLSClientConfig(cfg *tls.Config) TransportOption {
+	return func(t *Transport) { t.TLSClientConfig = cfg }
+}
+
+// WithTLSHandshakeTimeout sets Transport.TLSHandshakeTimeout.
+func WithTLSHandshakeTimeout(d time.Duration) TransportOption {
+	return func(t *Transport) { t.TLSHandshakeTimeout = d }
+}
+
+// WithWriteTimeout sets Transport.WriteTimeout.
+func WithWriteTimeout(d time.Duration) TransportOption {
+	return func(t *Transport) { t.WriteTimeout = d }
+}
+
+// WithResponseHeaderTimeout sets Transport.ResponseHeaderTimeout.
+func WithResponseHeaderTimeout(d time.Duration) TransportOption {
+	return func(t *Transport) { t.ResponseHeaderTimeout = d }
+}
+
+// WithExpectContinueTimeout sets Transport.ExpectContinueTimeout.
+func WithExpectContinueTimeout(d time.Duration) TransportOption {
+	return func(t *Transport) { t.ExpectContinueTimeout = d }
+}
+
+// WithMaxDrainBytes sets Transport.MaxDrainBytes.
+func WithMaxDrainBytes(n int64) TransportOption {
+	return func(t *Transport) { t.MaxDrainBytes = n }
+}
+
+// WithBufferSizes sets Transport.ReadBufferSize and Transport.WriteBufferSize.
+func WithBufferSizes(read, write int) TransportOption {
+	return func(t *Transport) {
+		t.ReadBufferSize = read
+		t.WriteBufferSize = write
+	}
+}
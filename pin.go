@@ -0,0 +1,150 @@
+package wire
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+var ErrCertNotPinned = errors.New("no certificate matches the pinned public keys")
+
+// CertPinMiddleware returns a Middleware which requires HTTPS connections to
+// the hosts in pins to present a certificate chain containing at least one of
+// the listed public keys. Keys are given as base64-encoded SHA-256 hashes of
+// the certificates' Subject Public Key Info. Round-trips over connections
+// which don't match fail with ErrCertNotPinned.
+//
+// Host names in pins may be glob patterns as understood by path.Match, such
+// as "*.example.com". Host names are matched case-insensitively. When several
+// patterns match a host, the most specific one (with the most literal
+// characters) applies. Hosts without any pins aren't checked.
+//
+// The check applies to idle connections being reused as well as to new ones,
+// but only works when next is (eventually) a Transport, and DialTLS returns
+// connections with a ConnectionState method (like *tls.Conn).
+func CertPinMiddleware(pins map[string][]string) Middleware {
+	pins = lowerPins(pins)
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if req.Scheme != "https" {
+			return next.RoundTrip(ctx, req)
+		}
+
+		want := lookupPins(pins, stripPort(req.Remote))
+		if want == nil {
+			return next.RoundTrip(ctx, req)
+		}
+
+		ctx = withConnCheck(ctx, func(raw net.Conn) error {
+			return checkPins(raw, want)
+		})
+
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// lowerPins returns a copy of pins with lower-case host names. The pins of
+// names which only differ in case are merged.
+func lowerPins(pins map[string][]string) map[string][]string {
+	lower := make(map[string][]string, len(pins))
+	for host, want := range pins {
+		host = strings.ToLower(host)
+		lower[host] = append(lower[host], want...)
+	}
+	return lower
+}
+
+// lookupPins returns the pins for host, preferring exact matches over glob
+// patterns, and more specific patterns (see moreSpecific) over others. The
+// host names in pins must be lower-case (see lowerPins).
+func lookupPins(pins map[string][]string, host string) []string {
+	host = strings.ToLower(host)
+
+	if want, ok := pins[host]; ok {
+		return want
+	}
+
+	var best string
+	var found bool
+
+	for pattern := range pins {
+		if !isGlob(pattern) || !matchHost(pattern, host) {
+			continue
+		}
+		if !found || moreSpecific(pattern, best) {
+			best, found = pattern, true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	return pins[best]
+}
+
+// checkPins verifies that the certificate chain presented over raw contains
+// at least one of the pinned keys.
+func checkPins(raw net.Conn, want []string) error {
+	tc, ok := raw.(interface {
+		ConnectionState() tls.ConnectionState
+	})
+	if !ok {
+		return ErrCertNotPinned
+	}
+
+	for _, cert := range tc.ConnectionState().PeerCertificates {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		hash := base64.StdEncoding.EncodeToString(sum[:])
+
+		for _, pin := range want {
+			if pin == hash {
+				return nil
+			}
+		}
+	}
+
+	return ErrCertNotPinned
+}
+
+type connCheckKey struct{}
+
+// withConnCheck returns a copy of ctx instructing Transport to run check on
+// the underlying network connection before using it for a round-trip. Any
+// checks already carried by ctx run first.
+func withConnCheck(ctx context.Context, check func(raw net.Conn) error) context.Context {
+	if prev, ok := ctx.Value(connCheckKey{}).(func(net.Conn) error); ok {
+		next := check
+		check = func(raw net.Conn) error {
+			if err := prev(raw); err != nil {
+				return err
+			}
+			return next(raw)
+		}
+	}
+
+	return context.WithValue(ctx, connCheckKey{}, check)
+}
+
+// checkConn runs the connection check carried by ctx (if any) on c. If the
+// check fails, c is closed, so it can't be handed to round-trips which don't
+// perform the check.
+func (t *Transport) checkConn(ctx context.Context, c *conn) (*conn, error) {
+	check, ok := ctx.Value(connCheckKey{}).(func(net.Conn) error)
+	if !ok {
+		return c, nil
+	}
+
+	if err := check(c.raw); err != nil {
+		c.close("error")
+		return nil, err
+	}
+
+	return c, nil
+}
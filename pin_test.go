@@ -0,0 +1,44 @@
+package wire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupPins(t *testing.T) {
+	pins := map[string][]string{
+		"API.example.com":    {"exact"},
+		"*.example.com":      {"wildcard"},
+		"*.eu.example.com":   {"eu"},
+		"*.??.example.com":   {"region"},
+		"*.*.example.com":    {"nested"},
+		"other.example.org":  {"other"},
+		"*.test.example.org": {"test"},
+	}
+
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{"api.example.com", []string{"exact"}},
+		{"Api.Example.COM", []string{"exact"}},
+		{"WWW.EU.example.com", []string{"eu"}},
+		{"www.example.com", []string{"wildcard"}},
+		{"www.eu.example.com", []string{"eu"}},
+		{"www.us.example.com", []string{"region"}},
+		{"www.usa.example.com", []string{"nested"}},
+		{"example.net", nil},
+	}
+
+	pins = lowerPins(pins)
+
+	for _, tt := range tests {
+		// Repeat the lookup, as map iteration order varies.
+		for i := 0; i < 20; i++ {
+			if got := lookupPins(pins, tt.host); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupPins(%q) = %v, want %v", tt.host, got, tt.want)
+				break
+			}
+		}
+	}
+}
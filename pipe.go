@@ -0,0 +1,129 @@
+package wire
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/erkl/heat"
+	"github.com/erkl/xo"
+)
+
+var ErrPipeClosed = errors.New("pipe has already been dialed")
+
+// A RequestHandler is the server end of a Pipe.
+type RequestHandler interface {
+	// ReadRequest reads the next request sent by the client. The request
+	// body, if any, should be read before the response is written.
+	ReadRequest() (*heat.Request, error)
+
+	// WriteResponse sends a response to the most recently read request.
+	// Response bodies with neither a Content-Length nor chunked transfer
+	// coding are terminated by closing the pipe, as they would be over a
+	// real connection.
+	WriteResponse(resp *heat.Response) error
+
+	// Close closes the server end of the pipe.
+	Close() error
+}
+
+// Pipe returns a client RoundTripper and a server RequestHandler, connected
+// by an in-memory, synchronous connection (see net.Pipe). Requests and
+// responses are serialized exactly as they would be over a real network.
+//
+// The client is a Transport which can only establish a single connection;
+// dialing a second time (for example because the server closed the first
+// connection) fails with ErrPipeClosed.
+func Pipe() (client RoundTripper, server RequestHandler) {
+	c, s := net.Pipe()
+
+	var once sync.Once
+	var dial = func(addr string) (net.Conn, error) {
+		var conn net.Conn
+		once.Do(func() { conn = c })
+		if conn == nil {
+			return nil, ErrPipeClosed
+		}
+		return conn, nil
+	}
+
+	t := &Transport{
+		Dial:    dial,
+		DialTLS: dial,
+	}
+
+	return t, &pipeServer{
+		raw: s,
+		r:   xo.NewReader(s, make([]byte, bufferSize)),
+		w:   xo.NewWriter(s, make([]byte, bufferSize)),
+	}
+}
+
+type pipeServer struct {
+	raw net.Conn
+	r   xo.Reader
+	w   xo.Writer
+
+	// Method of the most recently read request.
+	method string
+}
+
+func (s *pipeServer) ReadRequest() (*heat.Request, error) {
+	req, err := heat.ReadRequestHeader(s.r)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := heat.RequestBodySize(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if size != 0 {
+		r, err := heat.OpenBody(s.r, size)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(r)
+	}
+
+	s.method = req.Method
+	return req, nil
+}
+
+func (s *pipeServer) WriteResponse(resp *heat.Response) error {
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
+	size, err := heat.ResponseBodySize(resp, s.method)
+	if err != nil {
+		return err
+	}
+
+	if err := heat.WriteResponseHeader(s.w, resp); err != nil {
+		return err
+	}
+
+	if size != 0 && resp.Body != nil {
+		if err := heat.WriteBody(s.w, resp.Body, size); err != nil {
+			return err
+		}
+	}
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	// The only way to mark the end of an unbounded body.
+	if size == heat.Unbounded {
+		return s.raw.Close()
+	}
+
+	return nil
+}
+
+func (s *pipeServer) Close() error {
+	return s.raw.Close()
+}
@@ -0,0 +1,42 @@
+package wire
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+func TestPipeUnboundedResponse(t *testing.T) {
+	client, server := Pipe()
+	defer server.Close()
+
+	go func() {
+		if _, err := server.ReadRequest(); err != nil {
+			return
+		}
+
+		// No Content-Length, and no chunked coding.
+		resp := &heat.Response{Major: 1, Minor: 1, Status: 200, Reason: "OK"}
+		resp.Body = ioutil.NopCloser(strings.NewReader("until close"))
+		server.WriteResponse(resp)
+	}()
+
+	req, err := NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.RoundTrip(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil || string(data) != "until close" {
+		t.Fatalf("read (%q, %v), want %q", data, err, "until close")
+	}
+}
@@ -0,0 +1,109 @@
+package wire
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/erkl/heat"
+	"github.com/erkl/xo"
+)
+
+var ErrUnsupportedProxy = errors.New("unsupported proxy URL")
+var ErrTunnelRefused = errors.New("proxy refused CONNECT request")
+
+// proxy describes a parsed Transport.ProxyURL.
+type proxy struct {
+	// Address of the proxy server.
+	addr string
+
+	// Value of the Proxy-Authorization header field, if any.
+	auth string
+}
+
+func parseProxy(rawurl string) (*proxy, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" || u.Host == "" {
+		return nil, ErrUnsupportedProxy
+	}
+
+	p := &proxy{addr: defaultPort(u.Host, "80")}
+
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		cred := u.User.Username() + ":" + pass
+		p.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(cred))
+	}
+
+	return p, nil
+}
+
+// dialTunnel connects to addr through an HTTP CONNECT tunnel, then performs a
+// TLS handshake (using cfg, or TLSClientConfig if nil) over the tunnel.
+func (t *Transport) dialTunnel(p *proxy, addr string, cfg *tls.Config) (net.Conn, error) {
+	raw, err := t.dialer()(p.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tunnel(raw, p, addr); err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	tc, err := t.handshake(raw, addr, cfg)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+// tunnel asks the proxy at the other end of raw to open a tunnel to addr.
+func tunnel(raw net.Conn, p *proxy, addr string) error {
+	rbuf := getBuffer(bufferSize)
+	wbuf := getBuffer(bufferSize)
+	defer putBuffer(rbuf)
+	defer putBuffer(wbuf)
+
+	// The proxy won't send anything beyond its response header until we do,
+	// so there's no risk of the reader buffering bytes which belong to the
+	// tunnelled connection.
+	r := xo.NewReader(raw, rbuf)
+	w := xo.NewWriter(raw, wbuf)
+
+	req := &heat.Request{
+		Method: "CONNECT",
+		URI:    addr,
+		Major:  1,
+		Minor:  1,
+	}
+
+	req.Fields.Set("Host", addr)
+	if p.auth != "" {
+		req.Fields.Set("Proxy-Authorization", p.auth)
+	}
+
+	if err := heat.WriteRequestHeader(w, req); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	resp, err := heat.ReadResponseHeader(r)
+	if err != nil {
+		return err
+	}
+	if resp.Status != 200 {
+		return ErrTunnelRefused
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package wire
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/erkl/heat"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitMiddleware returns a Middleware which limits outbound requests to
+// rps requests per second, allowing bursts of up to burst requests. Requests
+// exceeding the limit block until they are allowed to proceed, or until their
+// context is done.
+func RateLimitMiddleware(rps float64, burst int) Middleware {
+	l := rate.NewLimiter(rate.Limit(rps), burst)
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if err := l.Wait(ctx); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// HostRateLimitMiddleware is like RateLimitMiddleware, except each remote
+// host is subject to its own, independent limit. The state kept for hosts is
+// dropped once their limits have fully recovered.
+func HostRateLimitMiddleware(rps float64, burst int) Middleware {
+	hl := newHostLimiters(rps, burst)
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		h := hl.acquire(req.Remote)
+		err := h.l.Wait(ctx)
+		hl.release(h)
+
+		if err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// hostLimiters holds a rate limiter for each host.
+type hostLimiters struct {
+	rps   float64
+	burst int
+
+	// How long a limiter must be idle for its bucket to refill, after
+	// which it's no different from a new one. Zero if it never refills.
+	idle time.Duration
+
+	// Mutex protecting the fields below.
+	mu sync.Mutex
+
+	// Limiters by host, and when idle ones were last removed.
+	m      map[string]*hostLimiter
+	pruned time.Time
+}
+
+type hostLimiter struct {
+	l *rate.Limiter
+
+	// Number of round-trips waiting on the limiter, and when the last one
+	// finished waiting.
+	users int
+	last  time.Time
+}
+
+func newHostLimiters(rps float64, burst int) *hostLimiters {
+	hl := &hostLimiters{
+		rps:   rps,
+		burst: burst,
+		m:     make(map[string]*hostLimiter),
+	}
+
+	if secs := float64(burst) / rps; rps > 0 && secs < float64(math.MaxInt64/time.Second) {
+		hl.idle = time.Duration(secs * float64(time.Second))
+	}
+
+	return hl
+}
+
+// acquire returns the limiter for host, which must be passed to release once
+// the caller is done waiting on it.
+func (hl *hostLimiters) acquire(host string) *hostLimiter {
+	now := time.Now()
+
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	// Sweep out idle limiters (at most once per idle period).
+	if hl.idle > 0 && now.Sub(hl.pruned) >= hl.idle {
+		for k, h := range hl.m {
+			if h.users == 0 && now.Sub(h.last) >= hl.idle {
+				delete(hl.m, k)
+			}
+		}
+		hl.pruned = now
+	}
+
+	h := hl.m[host]
+	if h == nil {
+		h = &hostLimiter{l: rate.NewLimiter(rate.Limit(hl.rps), hl.burst)}
+		hl.m[host] = h
+	}
+
+	h.users++
+	return h
+}
+
+func (hl *hostLimiters) release(h *hostLimiter) {
+	hl.mu.Lock()
+	h.users--
+	h.last = time.Now()
+	hl.mu.Unlock()
+}
@@ -0,0 +1,40 @@
+package wire
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHostLimitersEviction(t *testing.T) {
+	// Buckets refill within a millisecond.
+	hl := newHostLimiters(1000, 1)
+
+	busy := hl.acquire("busy.example.com")
+	for i := 0; i < 100; i++ {
+		hl.release(hl.acquire("host" + strconv.Itoa(i) + ".example.com"))
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	hl.release(hl.acquire("new.example.com"))
+
+	// Only the new limiter, and the one still in use, should remain.
+	if n := len(hl.m); n != 2 {
+		t.Errorf("%d limiters left, want 2", n)
+	}
+
+	hl.release(busy)
+}
+
+func TestHostLimitersNoRefill(t *testing.T) {
+	// Limiters which never refill must never be dropped.
+	hl := newHostLimiters(0, 1)
+
+	hl.release(hl.acquire("a.example.com"))
+	time.Sleep(time.Millisecond)
+	hl.release(hl.acquire("b.example.com"))
+
+	if n := len(hl.m); n != 2 {
+		t.Errorf("%d limiters left, want 2", n)
+	}
+}
@@ -0,0 +1,266 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/erkl/heat"
+)
+
+var ErrRecordingExhausted = errors.New("no more recorded round-trips to play back")
+
+// A recording describes a single recorded round-trip. Recordings are written
+// as JSON, one per line.
+type recording struct {
+	Request  recordedRequest   `json:"request"`
+	Response *recordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	// Identifies well-known errors (see replayedErrors), so they can be
+	// replayed as themselves.
+	ErrorKind string `json:"error_kind,omitempty"`
+}
+
+type recordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Fields heat.Fields `json:"fields"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	Major  int         `json:"major"`
+	Minor  int         `json:"minor"`
+	Status int         `json:"status"`
+	Reason string      `json:"reason"`
+	Fields heat.Fields `json:"fields"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// RecordingTransport returns a RoundTripper which passes requests on to
+// inner, and writes each round-trip to sink (as a line of JSON) so that it
+// can later be replayed by PlaybackTransport.
+//
+// Request and response bodies are read into memory in their entirety. The
+// values of header fields carrying credentials (Authorization,
+// Proxy-Authorization and Cookie in requests, and Set-Cookie in responses)
+// are redacted in the recording.
+func RecordingTransport(inner RoundTripper, sink io.Writer) RoundTripper {
+	var mu sync.Mutex
+	var enc = json.NewEncoder(sink)
+
+	return RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		rec, resp, err := record(ctx, inner, req)
+		if rec == nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		werr := enc.Encode(rec)
+		mu.Unlock()
+
+		if werr != nil {
+			return nil, werr
+		}
+
+		return resp, err
+	})
+}
+
+// record passes req on to rt, and returns a recording of the round-trip along
+// with its (buffered) response and error. Errors which prevent the round-trip
+// from being recorded are returned without a recording. Request and response
+// bodies are read into memory in their entirety.
+func record(ctx context.Context, rt RoundTripper, req *heat.Request) (*recording, *heat.Response, error) {
+	rec := &recording{
+		Request: recordedRequest{
+			Method: req.Method,
+			URL:    req.Scheme + "://" + req.Remote + req.URI,
+			Fields: redactFields(req.Fields, redactedRequestFields),
+		},
+	}
+
+	// Buffer the request body.
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rec.Request.Body = data
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+
+	resp, err := rt.RoundTrip(ctx, req)
+	if err != nil {
+		rec.Error = err.Error()
+		rec.ErrorKind = errorKind(err)
+		return rec, nil, err
+	}
+
+	// Buffer the response body.
+	var data []byte
+	if resp.Body != nil {
+		data, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rec.Response = &recordedResponse{
+		Major:  resp.Major,
+		Minor:  resp.Minor,
+		Status: resp.Status,
+		Reason: resp.Reason,
+		Fields: redactFields(resp.Fields, redactedResponseFields),
+		Body:   data,
+	}
+
+	return rec, withBody(resp, data), nil
+}
+
+// Header fields which are redacted in recordings.
+var redactedRequestFields = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+var redactedResponseFields = []string{"Set-Cookie"}
+
+// redactFields returns a copy of fields, with the values of the named fields
+// replaced.
+func redactFields(fields heat.Fields, names []string) heat.Fields {
+	dup := append(heat.Fields(nil), fields...)
+
+	for i, f := range dup {
+		for _, name := range names {
+			if strings.EqualFold(f.Name, name) {
+				dup[i].Value = "REDACTED"
+			}
+		}
+	}
+
+	return dup
+}
+
+// Errors which are recorded by kind, so that they can be compared against as
+// usual when replayed. Kinds must never change once added.
+var replayedErrors = []struct {
+	kind string
+	err  error
+}{
+	{"context.Canceled", context.Canceled},
+	{"context.DeadlineExceeded", context.DeadlineExceeded},
+	{"io.EOF", io.EOF},
+	{"io.ErrUnexpectedEOF", io.ErrUnexpectedEOF},
+	{"wire.ErrBodyTimeout", ErrBodyTimeout},
+	{"wire.ErrBodyTooLarge", ErrBodyTooLarge},
+	{"wire.ErrCertNotPinned", ErrCertNotPinned},
+	{"wire.ErrCircuitOpen", ErrCircuitOpen},
+	{"wire.ErrDialTimeout", ErrDialTimeout},
+	{"wire.ErrInvalidURL", ErrInvalidURL},
+	{"wire.ErrNoBackends", ErrNoBackends},
+	{"wire.ErrNoDialers", ErrNoDialers},
+	{"wire.ErrRedirectDowngrade", ErrRedirectDowngrade},
+	{"wire.ErrRedirectScheme", ErrRedirectScheme},
+	{"wire.ErrRequestBodyTooLarge", ErrRequestBodyTooLarge},
+	{"wire.ErrResponseHeaderTimeout", ErrResponseHeaderTimeout},
+	{"wire.ErrTooManyRedirects", ErrTooManyRedirects},
+	{"wire.ErrUnexpectedRequest", ErrUnexpectedRequest},
+	{"wire.ErrUnsizedHTTP10Body", ErrUnsizedHTTP10Body},
+	{"wire.ErrUnsupportedEncoding", ErrUnsupportedEncoding},
+	{"wire.ErrUnsupportedScheme", ErrUnsupportedScheme},
+}
+
+// errorKind returns the kind of the first error in replayedErrors which err
+// matches, if any.
+func errorKind(err error) string {
+	for _, e := range replayedErrors {
+		if errors.Is(err, e.err) {
+			return e.kind
+		}
+	}
+	return ""
+}
+
+// A replayedError is a replayed error which wrapped a well-known error when it
+// was recorded.
+type replayedError struct {
+	msg string
+	err error
+}
+
+func (e *replayedError) Error() string { return e.msg }
+func (e *replayedError) Unwrap() error { return e.err }
+
+// replay returns the recorded response, or the recorded error. Errors of a
+// known kind are replayed as the original error (or wrapping it, if that's
+// what the original did); others are replayed as new errors with the same
+// message.
+func (rec *recording) replay() (*heat.Response, error) {
+	if rec.Response == nil {
+		for _, e := range replayedErrors {
+			if e.kind != rec.ErrorKind {
+				continue
+			}
+			if e.err.Error() == rec.Error {
+				return nil, e.err
+			}
+			return nil, &replayedError{rec.Error, e.err}
+		}
+		return nil, errors.New(rec.Error)
+	}
+
+	resp := &heat.Response{
+		Major:  rec.Response.Major,
+		Minor:  rec.Response.Minor,
+		Status: rec.Response.Status,
+		Reason: rec.Response.Reason,
+		Fields: rec.Response.Fields,
+	}
+
+	if rec.Response.Body != nil {
+		resp.Body = newBytesBody(rec.Response.Body)
+	}
+
+	return resp, nil
+}
+
+// PlaybackTransport returns a RoundTripper which responds to requests with
+// the round-trips recorded by RecordingTransport, in the order they were
+// recorded. Requests themselves aren't inspected. Once all recorded
+// round-trips have been played back, round-trips fail with
+// ErrRecordingExhausted.
+//
+// Recorded errors are replayed with their original message, but only common
+// errors (such as context.Canceled, io.ErrUnexpectedEOF and this package's
+// round-trip errors) can be identified using errors.Is; other errors won't
+// match their originals.
+func PlaybackTransport(source io.Reader) RoundTripper {
+	var mu sync.Mutex
+	var dec = json.NewDecoder(source)
+
+	return RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		var rec recording
+
+		mu.Lock()
+		err := dec.Decode(&rec)
+		mu.Unlock()
+
+		if err == io.EOF {
+			return nil, ErrRecordingExhausted
+		} else if err != nil {
+			return nil, err
+		}
+
+		return rec.replay()
+	})
+}
@@ -0,0 +1,78 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+func TestRecordingRedactsCredentials(t *testing.T) {
+	var buf bytes.Buffer
+
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		if v, _ := req.Fields.Get("Authorization"); v != "Bearer secret" {
+			t.Errorf("request was sent with Authorization %q", v)
+		}
+		resp := &heat.Response{Status: 204}
+		resp.Fields.Set("Set-Cookie", "session=secret")
+		return resp, nil
+	})
+
+	req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+	req.Fields.Set("Authorization", "Bearer secret")
+	req.Fields.Set("Cookie", "session=secret")
+
+	if _, err := RecordingTransport(next, &buf).RoundTrip(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("recording contains credentials: %s", buf.String())
+	}
+	if v, _ := req.Fields.Get("Authorization"); v != "Bearer secret" {
+		t.Errorf("request's Authorization changed to %q", v)
+	}
+}
+
+func TestPlaybackErrors(t *testing.T) {
+	var buf bytes.Buffer
+
+	errs := []error{
+		context.DeadlineExceeded,
+		ErrTooManyRedirects,
+		// Same message as a well-known error, but not the same error.
+		errors.New(ErrCircuitOpen.Error()),
+		fmt.Errorf("dial example.com: %w", ErrDialTimeout),
+	}
+	for _, err := range errs {
+		err := err
+		next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+			return nil, err
+		})
+
+		req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+		RecordingTransport(next, &buf).RoundTrip(context.Background(), req)
+	}
+
+	rt := PlaybackTransport(&buf)
+	for _, want := range errs {
+		req := &heat.Request{Method: "GET", Scheme: "http", Remote: "example.com", URI: "/"}
+		_, err := rt.RoundTrip(context.Background(), req)
+		if err == nil || err.Error() != want.Error() {
+			t.Errorf("replayed %v, want %v", err, want)
+		}
+		for _, target := range []error{ErrCircuitOpen, ErrDialTimeout} {
+			if errors.Is(err, target) != errors.Is(want, target) {
+				t.Errorf("replayed %v, which doesn't match the original's identity", err)
+			}
+		}
+		if (want == context.DeadlineExceeded || want == ErrTooManyRedirects) && err != want {
+			t.Errorf("replayed %v, want %v itself", err, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+var ErrTooManyRedirects = errors.New("stopped after too many redirects")
+var ErrRedirectScheme = errors.New("refusing to follow redirect to unsupported scheme")
+var ErrRedirectDowngrade = errors.New("refusing to follow redirect from https to http")
+
+// DefaultMaxRedirects is the default value of RedirectPolicy's MaxRedirects
+// field.
+const DefaultMaxRedirects = 10
+
+// Up to this many bytes of a redirect response's body are read before it's
+// closed, so that the connection can be reused.
+const redirectDrainBytes = 4 << 10
+
+// A RedirectPolicy decides which redirects RedirectMiddleware follows.
+type RedirectPolicy struct {
+	// MaxRedirects is the maximum number of redirects followed for a single
+	// request. If zero, DefaultMaxRedirects is used.
+	MaxRedirects int
+
+	// ShouldFollow reports whether to follow the redirect from req (the
+	// request which resulted in resp) to the target URL, via being the
+	// number of redirects followed so far. If nil, all redirects are
+	// followed.
+	ShouldFollow func(req *heat.Request, resp *heat.Response, target string, via int) bool
+
+	// PreserveMethodOn lists the redirect status codes for which the
+	// original request method and body are kept. If nil, it defaults to
+	// 307 and 308, as required by RFC 7231 and RFC 7538.
+	PreserveMethodOn []int
+
+	// AllowDowngrade permits following redirects from https to http URLs.
+	AllowDowngrade bool
+}
+
+// RedirectMiddleware returns a Middleware which follows 301, 302, 303, 307 and
+// 308 redirects according to policy. Round-trips which would exceed the
+// maximum number of redirects fail with ErrTooManyRedirects. Redirects which
+// the policy declines to follow are returned as-is.
+//
+// Redirects with a status code in the policy's PreserveMethodOn list are
+// followed with the original method and body (which is buffered in memory
+// so that it can be sent again). Other redirects are followed with a GET
+// request (or HEAD, if that was the original method) without a body. Header
+// fields are copied from the original request, except that Authorization and
+// Cookie fields are dropped when redirected to a different host.
+//
+// Only redirects to http and https URLs are followed, so that a server can't
+// point the client at a local Unix socket (or another custom scheme), except
+// for redirects which stay on the same scheme and host. Redirects from https
+// to http are refused unless the policy allows downgrades. Round-trips with
+// refused redirects fail with ErrRedirectScheme or ErrRedirectDowngrade.
+func RedirectMiddleware(policy RedirectPolicy) Middleware {
+	max := policy.MaxRedirects
+	if max == 0 {
+		max = DefaultMaxRedirects
+	}
+
+	preserve := policy.PreserveMethodOn
+	if preserve == nil {
+		preserve = []int{307, 308}
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		// Buffer the request body, so it can be sent again.
+		var buf []byte
+		if req.Body != nil {
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			buf = b
+			req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		}
+
+		for via := 0; ; via++ {
+			resp, err := next.RoundTrip(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+
+			target, ok := redirectTarget(req, resp)
+			if !ok {
+				return resp, nil
+			}
+
+			if err := checkRedirect(req, target, policy.AllowDowngrade); err != nil {
+				discardBody(resp)
+				return nil, err
+			}
+
+			if policy.ShouldFollow != nil && !policy.ShouldFollow(req, resp, target, via) {
+				return resp, nil
+			}
+
+			discardBody(resp)
+
+			if via >= max {
+				return nil, ErrTooManyRedirects
+			}
+
+			keep := containsInt(preserve, resp.Status)
+			if req, err = redirectRequest(req, target, keep); err != nil {
+				return nil, err
+			}
+
+			// Once the body has been dropped, it stays dropped.
+			if !keep {
+				buf = nil
+			} else if buf != nil {
+				req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+			}
+		}
+	}
+}
+
+// redirectTarget returns the absolute URL resp redirects req to, if any.
+func redirectTarget(req *heat.Request, resp *heat.Response) (string, bool) {
+	switch resp.Status {
+	case 301, 302, 303, 307, 308:
+	default:
+		return "", false
+	}
+
+	loc, ok := resp.Fields.Get("Location")
+	if !ok {
+		return "", false
+	}
+
+	base, err := url.Parse(req.Scheme + "://" + req.Remote + req.URI)
+	if err != nil {
+		return "", false
+	}
+
+	ref, err := url.Parse(strings.TrimSpace(loc))
+	if err != nil {
+		return "", false
+	}
+
+	return base.ResolveReference(ref).String(), true
+}
+
+// checkRedirect verifies that following a redirect from req to target is
+// safe.
+func checkRedirect(req *heat.Request, target string, downgrade bool) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+
+	switch scheme := strings.ToLower(u.Scheme); {
+	case scheme == "http" && req.Scheme == "https" && !downgrade:
+		return ErrRedirectDowngrade
+	case scheme == "http" || scheme == "https":
+		return nil
+	case scheme == req.Scheme && strings.EqualFold(u.Host, req.Remote):
+		return nil
+	default:
+		return ErrRedirectScheme
+	}
+}
+
+// redirectRequest builds the request for following a redirect from req to
+// target. If keep is true, the method and body-related header fields of req
+// are kept (but the body itself isn't attached).
+func redirectRequest(req *heat.Request, target string, keep bool) (*heat.Request, error) {
+	scheme, remote, uri, err := parseURL(target)
+	if err != nil {
+		return nil, err
+	}
+
+	method := req.Method
+	if !keep && method != "HEAD" {
+		method = "GET"
+	}
+
+	dup := &heat.Request{
+		Method: method,
+		Scheme: scheme,
+		Remote: remote,
+		URI:    uri,
+		Major:  req.Major,
+		Minor:  req.Minor,
+		Fields: append(heat.Fields(nil), req.Fields...),
+	}
+
+	if !keep {
+		for _, name := range []string{"Content-Length", "Content-Type", "Transfer-Encoding", "Expect"} {
+			dup.Fields.Del(name)
+		}
+	}
+
+	if !strings.EqualFold(stripPort(remote), stripPort(req.Remote)) {
+		dup.Fields.Del("Authorization")
+		dup.Fields.Del("Cookie")
+	}
+
+	if dup.Fields.Has("Host") {
+		dup.Fields.Set("Host", remote)
+	}
+
+	return dup, nil
+}
+
+// discardBody reads a small amount of what's left of resp's body (so the
+// connection can be reused), and closes it.
+func discardBody(resp *heat.Response) {
+	if resp.Body != nil {
+		io.CopyN(ioutil.Discard, resp.Body, redirectDrainBytes)
+		resp.Body.Close()
+	}
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package wire
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+func TestRedirectSchemes(t *testing.T) {
+	tests := []struct {
+		from     string
+		location string
+		policy   RedirectPolicy
+		want     error
+	}{
+		{"http", "https://example.com/next", RedirectPolicy{}, nil},
+		{"http", "/next", RedirectPolicy{}, nil},
+		{"https", "https://example.org/next", RedirectPolicy{}, nil},
+		{"https", "http://example.com/next", RedirectPolicy{}, ErrRedirectDowngrade},
+		{"https", "http://example.com/next", RedirectPolicy{AllowDowngrade: true}, nil},
+		{"http", "http+unix:///var/run/docker.sock/containers/json", RedirectPolicy{}, ErrRedirectScheme},
+		{"https", "file:///etc/passwd", RedirectPolicy{}, ErrRedirectScheme},
+		{"http+unix", "/next", RedirectPolicy{}, nil},
+	}
+
+	for _, tt := range tests {
+		var hops int
+
+		next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+			if hops++; hops > 1 {
+				return &heat.Response{Status: 200}, nil
+			}
+			resp := &heat.Response{Status: 302}
+			resp.Fields.Set("Location", tt.location)
+			return resp, nil
+		})
+
+		req := &heat.Request{Method: "GET", Scheme: tt.from, Remote: "example.com", URI: "/", Major: 1, Minor: 1}
+
+		_, err := RedirectMiddleware(tt.policy)(context.Background(), req, next)
+		if err != tt.want {
+			t.Errorf("redirect from %s to %q: got error %v, want %v", tt.from, tt.location, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package wire
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/erkl/heat"
+)
+
+var ErrUnsupportedEncoding = errors.New("unsupported content coding")
+
+// Supported request body content codings.
+var encoders = map[string]func(w io.Writer) io.WriteCloser{
+	"gzip": func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	},
+	"deflate": func(w io.Writer) io.WriteCloser {
+		return zlib.NewWriter(w)
+	},
+}
+
+// RequestCompressionMiddleware returns a Middleware which compresses request
+// bodies using algo ("gzip" or "deflate"). As the size of compressed bodies
+// isn't known up front, the Transport sends them with chunked transfer coding.
+// The caller's request isn't modified. Bodies with a Content-Length smaller than minSize are sent as-is,
+// as are requests which already have a Content-Encoding header.
+//
+// Round-trips fail with ErrUnsupportedEncoding if algo isn't supported.
+func RequestCompressionMiddleware(algo string, minSize int64) Middleware {
+	encode := encoders[algo]
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if encode == nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, ErrUnsupportedEncoding
+		}
+
+		if req.Body == nil || req.Fields.Has("Content-Encoding") {
+			return next.RoundTrip(ctx, req)
+		}
+
+		// Leave small bodies alone.
+		if v, ok := req.Fields.Get("Content-Length"); ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && n < minSize {
+				return next.RoundTrip(ctx, req)
+			}
+		}
+
+		// Compress the body on the fly.
+		pr, pw := io.Pipe()
+
+		go func(body io.ReadCloser) {
+			w := encode(pw)
+
+			_, err := io.Copy(w, body)
+			if err == nil {
+				err = w.Close()
+			}
+
+			body.Close()
+			pw.CloseWithError(err)
+		}(req.Body)
+
+		// Compress into a copy, so that the caller's request can be sent
+		// again (by RetryMiddleware, say) and compressed anew.
+		dup := *req
+		dup.Body = pr
+		dup.Fields = append(heat.Fields(nil), req.Fields...)
+		dup.Fields.Del("Content-Length")
+		dup.Fields.Set("Content-Encoding", algo)
+
+		resp, err := next.RoundTrip(ctx, &dup)
+
+		// Stop the goroutine above if the body won't be consumed. After a
+		// successful round-trip the Transport may still be sending it.
+		if err != nil {
+			pr.CloseWithError(err)
+		}
+
+		return resp, err
+	}
+}
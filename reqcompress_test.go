@@ -0,0 +1,82 @@
+package wire
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// closeNotifier is an endless body which reports when it's closed.
+type closeNotifier struct {
+	zeros
+	closed chan struct{}
+}
+
+func (b *closeNotifier) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestRequestCompressionUnreadBody(t *testing.T) {
+	mw := RequestCompressionMiddleware("gzip", 0)
+
+	body := &closeNotifier{closed: make(chan struct{})}
+	req := &heat.Request{Method: "POST", Body: body}
+
+	// A RoundTripper which fails without touching the body.
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		return nil, context.Canceled
+	})
+
+	if _, err := mw(context.Background(), req, next); err != context.Canceled {
+		t.Fatalf("round-trip returned %v, want %v", err, context.Canceled)
+	}
+
+	select {
+	case <-body.closed:
+	case <-time.After(time.Second):
+		t.Fatal("original request body was never closed")
+	}
+}
+
+func TestRequestCompressionRetry(t *testing.T) {
+	mw := RequestCompressionMiddleware("gzip", 0)
+
+	req := &heat.Request{Method: "POST", Body: ioutil.NopCloser(strings.NewReader("hello"))}
+	req.Fields.Set("Content-Length", "5")
+
+	next := RoundTripperFunc(func(ctx context.Context, r *heat.Request) (*heat.Response, error) {
+		if v, _ := r.Fields.Get("Content-Encoding"); v != "gzip" {
+			t.Errorf("request sent with Content-Encoding %q", v)
+		}
+		if r.Fields.Has("Content-Length") || r.Fields.Has("Transfer-Encoding") {
+			t.Errorf("request sent with a size: %v", r.Fields)
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ioutil.ReadAll(zr); err != nil || string(data) != "hello" {
+			t.Errorf("decompressed (%q, %v), want %q", data, err, "hello")
+		}
+
+		return &heat.Response{Status: 204}, nil
+	})
+
+	// Send the request twice, as RetryMiddleware would.
+	for i := 0; i < 2; i++ {
+		req.Body = ioutil.NopCloser(strings.NewReader("hello"))
+		if _, err := mw(context.Background(), req, next); err != nil {
+			t.Fatal(err)
+		}
+		if req.Fields.Has("Content-Encoding") || !req.Fields.Has("Content-Length") {
+			t.Fatalf("caller's header fields modified: %v", req.Fields)
+		}
+	}
+}
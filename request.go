@@ -0,0 +1,112 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/erkl/heat"
+)
+
+// NewRequest returns a new HTTP/1.1 request for the absolute URL url, with a
+// Host header field and the given body (which may be nil).
+//
+// If body implements io.Seeker, the Content-Length header field is set to the
+// number of bytes remaining in it. Otherwise the Transport sends it with
+// chunked transfer coding (which HTTP/1.0 requests don't support), unless the
+// caller sets Content-Length. If body doesn't implement io.Closer, it's
+// wrapped with ioutil.NopCloser.
+func NewRequest(method, url string, body io.Reader) (*heat.Request, error) {
+	scheme, remote, uri, err := parseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &heat.Request{
+		Method: method,
+		Scheme: scheme,
+		Remote: remote,
+		URI:    uri,
+		Major:  1,
+		Minor:  1,
+	}
+
+	req.Fields.Set("Host", remote)
+
+	if body == nil {
+		return req, nil
+	}
+
+	if s, ok := body.(io.Seeker); ok {
+		n, err := remaining(s)
+		if err != nil {
+			return nil, err
+		}
+		req.Fields.Set("Content-Length", strconv.FormatInt(n, 10))
+	}
+
+	if rc, ok := body.(io.ReadCloser); ok {
+		req.Body = rc
+	} else {
+		req.Body = ioutil.NopCloser(body)
+	}
+
+	return req, nil
+}
+
+// Do issues req using rt, and returns its response. It's shorthand for
+// DoWithContext with context.Background().
+func Do(rt RoundTripper, req *heat.Request) (*heat.Response, error) {
+	return rt.RoundTrip(context.Background(), req)
+}
+
+// DoWithContext issues req using rt, aborting the round-trip if ctx is done
+// before the response header has been received.
+func DoWithContext(ctx context.Context, rt RoundTripper, req *heat.Request) (*heat.Response, error) {
+	return rt.RoundTrip(ctx, req)
+}
+
+// ContentLengthMiddleware returns a Middleware which sets the Content-Length
+// header field of requests whose body implements io.Seeker, and which have
+// neither a Content-Length nor a Transfer-Encoding header field, to the
+// number of bytes remaining in the body. Without it, such requests would be
+// sent using chunked encoding.
+func ContentLengthMiddleware() Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if req.Body == nil || req.Fields.Has("Content-Length") || req.Fields.Has("Transfer-Encoding") {
+			return next.RoundTrip(ctx, req)
+		}
+
+		if s, ok := req.Body.(io.Seeker); ok {
+			n, err := remaining(s)
+			if err != nil {
+				req.Body.Close()
+				return nil, err
+			}
+			req.Fields.Set("Content-Length", strconv.FormatInt(n, 10))
+		}
+
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// remaining returns the number of bytes between the current offset of s and
+// its end, leaving the offset unchanged.
+func remaining(s io.Seeker) (int64, error) {
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return end - cur, nil
+}
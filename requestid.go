@@ -0,0 +1,120 @@
+package wire
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/erkl/heat"
+)
+
+// A RequestID records the ID sent along with a request by RequestIDMiddleware,
+// and the ID echoed back by the server (if any).
+//
+// A RequestID is meant to describe exactly one round-trip. If a context
+// carrying one is used for several round-trips (including those made by
+// RetryMiddleware and RedirectMiddleware), it describes whichever finished
+// last. Use IDs to read the fields while round-trips may be in progress.
+type RequestID struct {
+	Sent     string
+	Received string
+
+	// Guards Sent and Received while round-trips are in progress.
+	mu sync.Mutex
+}
+
+// IDs returns the sent and received IDs.
+func (id *RequestID) IDs() (sent, received string) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	return id.Sent, id.Received
+}
+
+// set updates the sent and received IDs.
+func (id *RequestID) set(sent, received string) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	id.Sent, id.Received = sent, received
+}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying a new RequestID, which
+// RequestIDMiddleware fills in when ctx is used for a round-trip.
+func ContextWithRequestID(ctx context.Context) (context.Context, *RequestID) {
+	id := new(RequestID)
+	return context.WithValue(ctx, requestIDKey{}, id), id
+}
+
+// RequestIDFromContext returns the RequestID carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) (*RequestID, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(*RequestID)
+	return id, ok
+}
+
+// RequestIDMiddleware returns a Middleware which tags each request with a
+// unique ID, sent in the given header field. Requests which already have the
+// header keep their existing ID. IDs are generated by gen, which must be safe
+// for concurrent use; if nil, random (version 4) UUIDs are used.
+//
+// The sent ID, along with the value of the same header field in the response,
+// is stored in the context's RequestID. Callers which want to know the IDs
+// must seed the context themselves, using ContextWithRequestID, before
+// making the round-trip. If the context doesn't carry a RequestID, a new one
+// is added, but it's only visible to subsequent middleware (although the sent
+// ID can still be found in the request's header fields).
+func RequestIDMiddleware(header string, gen func() string) Middleware {
+	if gen == nil {
+		gen = newUUID
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		id, ok := RequestIDFromContext(ctx)
+		if !ok {
+			ctx, id = ContextWithRequestID(ctx)
+		}
+
+		sent, ok := req.Fields.Get(header)
+		if !ok {
+			sent = gen()
+			req.Fields.Set(header, sent)
+		}
+
+		id.set(sent, "")
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		received, _ := resp.Fields.Get(header)
+		id.set(sent, received)
+
+		return resp, nil
+	}
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+
+	return string(s[:])
+}
@@ -0,0 +1,36 @@
+package wire
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+func TestRequestIDConcurrent(t *testing.T) {
+	mw := RequestIDMiddleware("X-Request-Id", nil)
+	ctx, id := ContextWithRequestID(context.Background())
+
+	next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		resp := &heat.Response{Status: 204}
+		v, _ := req.Fields.Get("X-Request-Id")
+		resp.Fields.Set("X-Request-Id", v)
+		return resp, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mw(ctx, new(heat.Request), next)
+			id.IDs()
+		}()
+	}
+	wg.Wait()
+
+	if sent, received := id.IDs(); sent == "" || sent != received {
+		t.Errorf("IDs returned (%q, %q)", sent, received)
+	}
+}
@@ -0,0 +1,39 @@
+package wire
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/erkl/heat"
+)
+
+// DefaultMaxBodySize is the maximum number of bytes read by ReadResponseBody.
+const DefaultMaxBodySize = 10 << 20
+
+// ReadResponseBody reads resp.Body in its entirety and closes it. Bodies
+// longer than DefaultMaxBodySize bytes aren't read past the limit, and cause
+// ErrBodyTooLarge to be returned.
+func ReadResponseBody(resp *heat.Response) ([]byte, error) {
+	return ReadResponseBodyLimit(resp, DefaultMaxBodySize)
+}
+
+// ReadResponseBodyLimit is like ReadResponseBody, except it reads at most
+// limit bytes.
+func ReadResponseBodyLimit(resp *heat.Response, limit int64) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the limit, to tell whether there's more.
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+
+	return data, nil
+}
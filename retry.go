@@ -0,0 +1,131 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// DefaultMaxAttempts is the default value of RetryPolicy's MaxAttempts field.
+const DefaultMaxAttempts = 3
+
+// A RetryPolicy decides whether, and when, failed round-trips should be
+// retried by RetryMiddleware.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request will be issued,
+	// including the first attempt. If zero, DefaultMaxAttempts is used.
+	MaxAttempts int
+
+	// Backoff decides how long to wait before each retry. If nil, retries
+	// are issued immediately.
+	Backoff BackoffPolicy
+
+	// ShouldRetry reports whether a round-trip which returned resp and err
+	// should be retried. If nil, requests are retried when the round-trip
+	// fails outright, or when the server responds with 502, 503 or 504.
+	ShouldRetry func(resp *heat.Response, err error) bool
+
+	// Requests using non-idempotent methods (such as POST) are never
+	// retried unless RetryNonIdempotent is true.
+	RetryNonIdempotent bool
+}
+
+// RetryMiddleware returns a Middleware which retries failed round-trips
+// according to policy.
+//
+// Request bodies are buffered in memory so that they can be sent again.
+func RetryMiddleware(policy RetryPolicy) Middleware {
+	max := policy.MaxAttempts
+	if max == 0 {
+		max = DefaultMaxAttempts
+	}
+
+	shouldRetry := policy.ShouldRetry
+	if shouldRetry == nil {
+		shouldRetry = defaultShouldRetry
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if max <= 1 || !(policy.RetryNonIdempotent || idempotent(req.Method)) {
+			return next.RoundTrip(ctx, req)
+		}
+
+		// Buffer the request body, so it can be replayed.
+		var buf []byte
+		if req.Body != nil {
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			buf = b
+		}
+
+		for attempt := 0; ; attempt++ {
+			if req.Body != nil {
+				req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+			}
+
+			resp, err := next.RoundTrip(ctx, req)
+
+			// Give up if we've run out of attempts, if the context is
+			// done, or if the policy says so.
+			if attempt+1 >= max || ctx.Err() != nil || !shouldRetry(resp, err) {
+				return resp, err
+			}
+
+			// Discard the failed response.
+			if resp != nil && resp.Body != nil {
+				resp.Body.Close()
+			}
+
+			if policy.Backoff != nil {
+				if err := sleep(ctx, policy.Backoff.Wait(attempt+1)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
+
+func defaultShouldRetry(resp *heat.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.Status {
+	case 502, 503, 504:
+		return true
+	default:
+		return false
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d to pass, or for ctx to be done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
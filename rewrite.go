@@ -0,0 +1,54 @@
+package wire
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/erkl/heat"
+)
+
+// A RewriteRule describes how URLRewriteMiddleware should rewrite requests.
+type RewriteRule struct {
+	// Pattern is matched against the request URI (path and query). Rules
+	// with a nil Pattern match all requests.
+	Pattern *regexp.Regexp
+
+	// Replacement is the template used to build the new request URI, as
+	// with regexp.Regexp.ReplaceAllString (so it may refer to submatches
+	// using $1, $name and so on). If empty, the request URI is left as-is.
+	Replacement string
+
+	// Scheme and Host, if not empty, replace the request's scheme and
+	// remote host.
+	Scheme string
+	Host   string
+}
+
+// URLRewriteMiddleware returns a Middleware which rewrites request URLs using
+// the first matching rule (if any) before passing them on.
+func URLRewriteMiddleware(rules []RewriteRule) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		for _, r := range rules {
+			if r.Pattern != nil && !r.Pattern.MatchString(req.URI) {
+				continue
+			}
+
+			if r.Pattern != nil && r.Replacement != "" {
+				req.URI = r.Pattern.ReplaceAllString(req.URI, r.Replacement)
+			}
+			if r.Scheme != "" {
+				req.Scheme = r.Scheme
+			}
+			if r.Host != "" {
+				req.Remote = r.Host
+				if req.Fields.Has("Host") {
+					req.Fields.Set("Host", r.Host)
+				}
+			}
+
+			break
+		}
+
+		return next.RoundTrip(ctx, req)
+	}
+}
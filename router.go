@@ -0,0 +1,107 @@
+package wire
+
+import (
+	"context"
+	"net"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+// HostRouterMiddleware returns a Middleware which dispatches each request to
+// the RoundTripper registered for its remote host in routes. Requests for
+// unregistered hosts are passed to fallback or, if fallback is nil, to the
+// next RoundTripper in the chain.
+//
+// Keys may be exact host names (optionally including a port), or glob
+// patterns as understood by path.Match, such as "*.internal". Host names are
+// matched case-insensitively. Exact matches take precedence over patterns,
+// and when several patterns match, the most specific one (with the most
+// literal characters) wins, as in CertPinMiddleware.
+func HostRouterMiddleware(routes map[string]RoundTripper, fallback RoundTripper) Middleware {
+	var exact = make(map[string]RoundTripper)
+	var globs []string
+
+	for k, rt := range routes {
+		if isGlob(k) {
+			globs = append(globs, k)
+		} else {
+			exact[strings.ToLower(k)] = rt
+		}
+	}
+
+	sort.Slice(globs, func(i, j int) bool {
+		return moreSpecific(globs[i], globs[j])
+	})
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		remote := strings.ToLower(req.Remote)
+		host := stripPort(remote)
+
+		if rt, ok := exact[remote]; ok {
+			return rt.RoundTrip(ctx, req)
+		}
+		if rt, ok := exact[host]; ok {
+			return rt.RoundTrip(ctx, req)
+		}
+
+		for _, g := range globs {
+			if matchHost(g, remote) || matchHost(g, host) {
+				return routes[g].RoundTrip(ctx, req)
+			}
+		}
+
+		if fallback != nil {
+			return fallback.RoundTrip(ctx, req)
+		}
+		return next.RoundTrip(ctx, req)
+	}
+}
+
+// isGlob reports whether pattern contains any glob metacharacters.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// moreSpecific reports whether glob pattern a is more specific than b: whether
+// it has more literal characters or, failing that, is longer (as "?" is more
+// specific than "*"). Remaining ties are broken lexically, so that the order
+// never depends on map iteration order.
+func moreSpecific(a, b string) bool {
+	if n, m := literalLen(a), literalLen(b); n != m {
+		return n > m
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a < b
+}
+
+// literalLen returns the number of characters in a glob pattern which aren't
+// special to path.Match.
+func literalLen(pattern string) int {
+	var n int
+	for _, c := range pattern {
+		if !strings.ContainsRune(`*?[]\^-`, c) {
+			n++
+		}
+	}
+	return n
+}
+
+// matchHost reports whether host matches the glob pattern. Malformed patterns
+// match nothing.
+func matchHost(pattern, host string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return ok && err == nil
+}
+
+// stripPort returns addr without its port, if it has one.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
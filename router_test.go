@@ -0,0 +1,44 @@
+package wire
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erkl/heat"
+)
+
+// named returns a RoundTripper which responds with a Reason of name.
+func named(name string) RoundTripper {
+	return RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		return &heat.Response{Status: 204, Reason: name}, nil
+	})
+}
+
+func TestHostRouter(t *testing.T) {
+	mw := HostRouterMiddleware(map[string]RoundTripper{
+		"api.example.com": named("exact"),
+		"*.example.com":   named("wildcard"),
+		"a??.example.com": named("questions"),
+		"*":               named("any"),
+	}, nil)
+
+	tests := map[string]string{
+		"api.example.com":     "exact",
+		"API.Example.com":     "exact",
+		"API.example.com:443": "exact",
+		"abc.example.com":     "questions",
+		"abcd.example.com":    "wildcard",
+		"example.org":         "any",
+	}
+
+	for remote, want := range tests {
+		req := &heat.Request{Method: "GET", Scheme: "https", Remote: remote, URI: "/"}
+		resp, err := mw(context.Background(), req, notImplemented)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Reason != want {
+			t.Errorf("%s was routed to %q, want %q", remote, resp.Reason, want)
+		}
+	}
+}
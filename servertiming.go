@@ -0,0 +1,104 @@
+package wire
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// A MetricsCollector receives named duration measurements.
+type MetricsCollector interface {
+	Observe(name string, d time.Duration)
+}
+
+// The MetricsCollectorFunc type is an adapter to allow the use of ordinary
+// functions as metrics collectors.
+type MetricsCollectorFunc func(name string, d time.Duration)
+
+// Observe calls fn(name, d).
+func (fn MetricsCollectorFunc) Observe(name string, d time.Duration) {
+	fn(name, d)
+}
+
+// ServerTimingMiddleware returns a Middleware which parses the Server-Timing
+// header fields of responses, and passes each metric's name and duration to
+// collector. For example, "db;dur=53.2, app;desc=\"render\";dur=47" results
+// in observations of 53.2ms for "db" and 47ms for "app". Metrics without a
+// duration are ignored, as are Server-Timing trailer fields.
+func ServerTimingMiddleware(collector MetricsCollector) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range resp.Fields {
+			if !strings.EqualFold(f.Name, "Server-Timing") {
+				continue
+			}
+
+			for _, metric := range splitQuoted(f.Value, ',') {
+				if name, d, ok := parseServerTiming(metric); ok {
+					collector.Observe(name, d)
+				}
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// parseServerTiming parses a single metric from a Server-Timing header field,
+// such as `db;dur=53.2;desc="query"`. The duration is given in milliseconds.
+func parseServerTiming(metric string) (string, time.Duration, bool) {
+	params := splitQuoted(metric, ';')
+
+	name := strings.TrimSpace(params[0])
+	if name == "" {
+		return "", 0, false
+	}
+
+	for _, p := range params[1:] {
+		i := strings.IndexByte(p, '=')
+		if i < 0 || !strings.EqualFold(strings.TrimSpace(p[:i]), "dur") {
+			continue
+		}
+
+		ms, err := strconv.ParseFloat(strings.Trim(strings.TrimSpace(p[i+1:]), `"`), 64)
+		if err != nil || ms < 0 || math.IsNaN(ms) || math.IsInf(ms, 0) {
+			return "", 0, false
+		}
+
+		return name, time.Duration(ms * float64(time.Millisecond)), true
+	}
+
+	return "", 0, false
+}
+
+// splitQuoted splits s at each instance of sep which isn't part of a quoted
+// string.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	var quoted, escaped bool
+	var start int
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
@@ -0,0 +1,31 @@
+package wire
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	tests := []struct {
+		metric string
+		name   string
+		d      time.Duration
+		ok     bool
+	}{
+		{`db;dur=53.2`, "db", 53200 * time.Microsecond, true},
+		{`app;desc="a;b";dur="47"`, "app", 47 * time.Millisecond, true},
+		{`cache;desc="hit"`, "", 0, false},
+		{`db;dur=-1`, "", 0, false},
+		{`db;dur=NaN`, "", 0, false},
+		{`db;dur=Inf`, "", 0, false},
+		{`db;dur=-Inf`, "", 0, false},
+	}
+
+	for _, tt := range tests {
+		name, d, ok := parseServerTiming(tt.metric)
+		if name != tt.name || d != tt.d || ok != tt.ok {
+			t.Errorf("parseServerTiming(%q) = (%q, %v, %v), want (%q, %v, %v)",
+				tt.metric, name, d, ok, tt.name, tt.d, tt.ok)
+		}
+	}
+}
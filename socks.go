@@ -0,0 +1,171 @@
+package wire
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+)
+
+var ErrSOCKSCredentials = errors.New("SOCKS5 username or password too long")
+var ErrSOCKSHandshake = errors.New("SOCKS5 handshake failed")
+var ErrSOCKSAuth = errors.New("SOCKS5 authentication failed")
+var ErrSOCKSConnect = errors.New("SOCKS5 proxy failed to connect")
+
+const (
+	socksVersion = 5
+
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+
+	socksConnect = 0x01
+
+	socksIPv4   = 0x01
+	socksDomain = 0x03
+	socksIPv6   = 0x04
+)
+
+// NewSOCKS5Dialer returns a dial function which connects to addresses through
+// the SOCKS5 proxy at proxyAddr (as per RFC 1928). If username is not empty,
+// the proxy is authenticated with using username and password (RFC 1929).
+//
+// The returned function is suitable for use as Transport.Dial. To use it for
+// TLS connections, wrap the returned net.Conn with tls.Client.
+func NewSOCKS5Dialer(proxyAddr, username, password string) (func(addr string) (net.Conn, error), error) {
+	if len(username) > 255 || len(password) > 255 {
+		return nil, ErrSOCKSCredentials
+	}
+
+	return func(addr string) (net.Conn, error) {
+		c, err := net.Dial("tcp", proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := socksHandshake(c, addr, username, password); err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		return c, nil
+	}, nil
+}
+
+func socksHandshake(c net.Conn, addr, username, password string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	var buf = make([]byte, 0, 6+len(host))
+
+	// Negotiate an authentication method.
+	if username != "" {
+		buf = append(buf, socksVersion, 2, socksAuthNone, socksAuthPassword)
+	} else {
+		buf = append(buf, socksVersion, 1, socksAuthNone)
+	}
+
+	if _, err := c.Write(buf); err != nil {
+		return err
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(c, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return ErrSOCKSHandshake
+	}
+
+	switch reply[1] {
+	case socksAuthNone:
+		// Nothing to do.
+
+	case socksAuthPassword:
+		if username == "" {
+			return ErrSOCKSHandshake
+		}
+
+		buf = append(buf[:0], 1, byte(len(username)))
+		buf = append(buf, username...)
+		buf = append(buf, byte(len(password)))
+		buf = append(buf, password...)
+
+		if _, err := c.Write(buf); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(c, reply[:]); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return ErrSOCKSAuth
+		}
+
+	default:
+		return ErrSOCKSHandshake
+	}
+
+	// Issue the CONNECT command.
+	buf = append(buf[:0], socksVersion, socksConnect, 0)
+
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return ErrSOCKSHandshake
+		}
+		buf = append(buf, socksDomain, byte(len(host)))
+		buf = append(buf, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		buf = append(buf, socksIPv4)
+		buf = append(buf, ip4...)
+	} else {
+		buf = append(buf, socksIPv6)
+		buf = append(buf, ip...)
+	}
+
+	buf = append(buf, byte(port>>8), byte(port))
+
+	if _, err := c.Write(buf); err != nil {
+		return err
+	}
+
+	// Read the reply, up to and including the type of the bound address.
+	var head [4]byte
+	if _, err := io.ReadFull(c, head[:]); err != nil {
+		return err
+	}
+	if head[0] != socksVersion {
+		return ErrSOCKSHandshake
+	}
+	if head[1] != 0 {
+		return ErrSOCKSConnect
+	}
+
+	// Discard the bound address and port.
+	var n int
+	switch head[3] {
+	case socksIPv4:
+		n = net.IPv4len
+	case socksIPv6:
+		n = net.IPv6len
+	case socksDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(c, l[:]); err != nil {
+			return err
+		}
+		n = int(l[0])
+	default:
+		return ErrSOCKSHandshake
+	}
+
+	if _, err := io.ReadFull(c, make([]byte, n+2)); err != nil {
+		return err
+	}
+
+	return nil
+}
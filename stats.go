@@ -0,0 +1,39 @@
+package wire
+
+// PoolStats is a snapshot of a Transport's idle connection pool.
+type PoolStats struct {
+	// Number of idle plain TCP and TLS connections.
+	IdleTCP int
+	IdleTLS int
+
+	// Total number of idle connections (IdleTCP + IdleTLS).
+	TotalIdleConns int
+
+	// Number of idle connections per host, keyed by "host:port".
+	PerHost map[string]int
+}
+
+// Stats returns a snapshot of the Transport's idle connection pool.
+func (t *Transport) Stats() PoolStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := PoolStats{
+		PerHost: make(map[string]int),
+	}
+
+	for key, c := range t.idleConns {
+		host := key.host()
+		for ; c != nil; c = c.next {
+			if c.tls {
+				s.IdleTLS++
+			} else {
+				s.IdleTCP++
+			}
+			s.PerHost[host]++
+		}
+	}
+
+	s.TotalIdleConns = s.IdleTCP + s.IdleTLS
+	return s
+}
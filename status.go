@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/erkl/heat"
+)
+
+// DefaultStatusBodyLimit is the number of response body bytes captured by
+// ExpectStatusMiddleware when the response status is unexpected.
+const DefaultStatusBodyLimit = 1024
+
+// An UnexpectedStatusError is returned by ExpectStatusMiddleware when the
+// server responds with a status code other than those expected.
+type UnexpectedStatusError struct {
+	Got  int
+	Want []int
+
+	// Resp is the offending response. Its body has already been closed;
+	// up to the configured limit of it is available in Body.
+	Resp *heat.Response
+	Body []byte
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	msg := fmt.Sprintf("unexpected response status %d (want %v)", e.Got, e.Want)
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+	return msg
+}
+
+// ExpectStatusMiddleware returns a Middleware which fails round-trips with an
+// *UnexpectedStatusError when the response status code isn't one of codes.
+// The first DefaultStatusBodyLimit bytes of the response body are included in
+// the error.
+func ExpectStatusMiddleware(codes ...int) Middleware {
+	return ExpectStatusLimitMiddleware(DefaultStatusBodyLimit, codes...)
+}
+
+// ExpectStatusLimitMiddleware is like ExpectStatusMiddleware, except up to
+// limit bytes of the response body are included in errors.
+func ExpectStatusLimitMiddleware(limit int64, codes ...int) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, code := range codes {
+			if resp.Status == code {
+				return resp, nil
+			}
+		}
+
+		e := &UnexpectedStatusError{
+			Got:  resp.Status,
+			Want: codes,
+			Resp: resp,
+		}
+
+		if resp.Body != nil {
+			// A failure to read the body shouldn't mask the actual error.
+			e.Body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+			resp.Body.Close()
+			resp.Body = nil
+		}
+
+		return nil, e
+	}
+}
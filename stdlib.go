@@ -0,0 +1,174 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/erkl/heat"
+)
+
+// StdlibAdapter returns an http.RoundTripper which issues requests using rt,
+// allowing it to be used by an http.Client (and anything else built on the
+// net/http package).
+//
+// Requests with a body of unknown length (a ContentLength of zero or less)
+// are sent without a Content-Length header field, which for a Transport means
+// they're sent using chunked encoding.
+func StdlibAdapter(rt RoundTripper) http.RoundTripper {
+	return stdlibAdapter{rt}
+}
+
+type stdlibAdapter struct {
+	rt RoundTripper
+}
+
+func (a stdlibAdapter) RoundTrip(hr *http.Request) (*http.Response, error) {
+	req := &heat.Request{
+		Method: hr.Method,
+		Scheme: hr.URL.Scheme,
+		Remote: hr.URL.Host,
+		URI:    hr.URL.RequestURI(),
+		Major:  1,
+		Minor:  1,
+	}
+
+	host := hr.Host
+	if host == "" {
+		host = hr.URL.Host
+	}
+	req.Fields.Set("Host", host)
+
+	for _, name := range sortedHeaderKeys(hr.Header) {
+		for _, v := range hr.Header[name] {
+			req.Fields.Add(name, v)
+		}
+	}
+
+	if hr.Close {
+		req.Fields.Set("Connection", "close")
+	}
+
+	if hr.Body != nil && hr.Body != http.NoBody {
+		req.Body = hr.Body
+		if hr.ContentLength > 0 {
+			req.Fields.Set("Content-Length", strconv.FormatInt(hr.ContentLength, 10))
+		}
+	}
+
+	resp, err := a.rt.RoundTrip(hr.Context(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := resp.Reason
+	if reason == "" {
+		reason = http.StatusText(resp.Status)
+	}
+
+	r := &http.Response{
+		Status:        strconv.Itoa(resp.Status) + " " + reason,
+		StatusCode:    resp.Status,
+		Proto:         "HTTP/" + strconv.Itoa(resp.Major) + "." + strconv.Itoa(resp.Minor),
+		ProtoMajor:    resp.Major,
+		ProtoMinor:    resp.Minor,
+		Header:        make(http.Header),
+		Body:          resp.Body,
+		ContentLength: -1,
+		Close:         heat.Closing(resp.Major, resp.Minor, resp.Fields),
+		Request:       hr,
+	}
+
+	for _, f := range resp.Fields {
+		r.Header.Add(f.Name, f.Value)
+	}
+
+	if v, ok := resp.Fields.Get("Content-Length"); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			r.ContentLength = n
+		}
+	}
+
+	if r.Body == nil {
+		r.Body = http.NoBody
+		r.ContentLength = 0
+	}
+
+	return r, nil
+}
+
+// FromStdlib returns a RoundTripper which issues requests using the
+// http.RoundTripper rt (such as an http.Transport), allowing this package's
+// middleware to be used on top of it.
+func FromStdlib(rt http.RoundTripper) RoundTripper {
+	return RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+		// Avoid passing a typed nil io.Reader.
+		var body io.Reader
+		if req.Body != nil {
+			body = req.Body
+		}
+
+		hr, err := http.NewRequestWithContext(ctx, req.Method, req.Scheme+"://"+req.Remote+req.URI, body)
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+
+		// Header fields which the net/http package manages itself are
+		// translated into their http.Request counterparts.
+		for _, f := range req.Fields {
+			switch {
+			case strings.EqualFold(f.Name, "Host"):
+				hr.Host = f.Value
+			case strings.EqualFold(f.Name, "Content-Length"):
+				hr.ContentLength, _ = strconv.ParseInt(f.Value, 10, 64)
+			case strings.EqualFold(f.Name, "Transfer-Encoding"):
+			case strings.EqualFold(f.Name, "Connection"):
+				hr.Close = heat.Closing(req.Major, req.Minor, req.Fields)
+			default:
+				hr.Header.Add(f.Name, f.Value)
+			}
+		}
+
+		r, err := rt.RoundTrip(hr)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &heat.Response{
+			Major:  r.ProtoMajor,
+			Minor:  r.ProtoMinor,
+			Status: r.StatusCode,
+			Reason: strings.TrimPrefix(r.Status, strconv.Itoa(r.StatusCode)+" "),
+			Body:   r.Body,
+		}
+
+		for _, name := range sortedHeaderKeys(r.Header) {
+			for _, v := range r.Header[name] {
+				resp.Fields.Add(name, v)
+			}
+		}
+
+		if r.Body == http.NoBody {
+			resp.Body = nil
+		}
+
+		return resp, nil
+	})
+}
+
+// sortedHeaderKeys returns the keys of h in sorted order, so header fields
+// are translated deterministically.
+func sortedHeaderKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// BodyTapMiddleware returns a Middleware which passes a copy of each response
+// body to tap as it is being read, without buffering it. The tap function is
+// called in its own goroutine, with an io.PipeReader which yields the same
+// bytes as the response body.
+//
+// The tap reader reaches EOF when the body has been read in its entirety. If
+// the body is closed early, or a read fails, the tap reader fails with
+// io.ErrUnexpectedEOF or the read error respectively.
+//
+// Reading the body blocks until the tap has consumed the bytes read, so tap
+// should read promptly. Once tap returns, the remainder of the body is no
+// longer copied. Responses without a body aren't tapped.
+func BodyTapMiddleware(tap func(resp *heat.Response, r io.Reader)) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil || resp.Body == nil {
+			return resp, err
+		}
+
+		pr, pw := io.Pipe()
+
+		go func() {
+			tap(resp, pr)
+			pr.Close()
+		}()
+
+		resp.Body = &tappedBody{r: resp.Body, w: pw}
+		return resp, nil
+	}
+}
+
+// Compile-time type check.
+var _ BodyReader = new(tappedBody)
+
+type tappedBody struct {
+	r io.ReadCloser
+	w *io.PipeWriter
+}
+
+func (b *tappedBody) Read(buf []byte) (int, error) {
+	n, err := b.r.Read(buf)
+	if n > 0 {
+		// Errors here only mean the tap has stopped reading.
+		b.w.Write(buf[:n])
+	}
+
+	if err == io.EOF {
+		b.w.Close()
+	} else if err != nil {
+		b.w.CloseWithError(err)
+	}
+
+	return n, err
+}
+
+func (b *tappedBody) SetReadDeadline(t time.Time) error {
+	if br, ok := b.r.(BodyReader); ok {
+		return br.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (b *tappedBody) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
+func (b *tappedBody) Peek(n int) ([]byte, error) {
+	return peekBody(b.r, n)
+}
+
+func (b *tappedBody) Close() error {
+	// Has no effect if the pipe has already been closed.
+	b.w.CloseWithError(io.ErrUnexpectedEOF)
+	return b.r.Close()
+}
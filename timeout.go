@@ -0,0 +1,67 @@
+package wire
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+// TimeoutMiddleware returns a Middleware which aborts round-trips that take
+// longer than d. The deadline also applies to reading the response body.
+func TimeoutMiddleware(d time.Duration) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		return roundTripTimeout(ctx, req, next, d)
+	}
+}
+
+// HostTimeoutMiddleware is like TimeoutMiddleware, except the timeout depends
+// on the request's remote host. Keys in timeouts are host names, optionally
+// including a port, and are matched case-insensitively; a key with a port
+// takes precedence over one without. Requests for other hosts use fallback.
+// A non-positive timeout means round-trips aren't limited.
+func HostTimeoutMiddleware(timeouts map[string]time.Duration, fallback time.Duration) Middleware {
+	var lower = make(map[string]time.Duration, len(timeouts))
+	for host, d := range timeouts {
+		lower[strings.ToLower(host)] = d
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		remote := strings.ToLower(req.Remote)
+
+		d, ok := lower[remote]
+		if !ok {
+			if d, ok = lower[stripPort(remote)]; !ok {
+				d = fallback
+			}
+		}
+
+		if d <= 0 {
+			return next.RoundTrip(ctx, req)
+		}
+
+		return roundTripTimeout(ctx, req, next, d)
+	}
+}
+
+// roundTripTimeout passes req on to next, aborting the round-trip (including
+// reading the response body) after d.
+func roundTripTimeout(ctx context.Context, req *heat.Request, next RoundTripper, d time.Duration) (*heat.Response, error) {
+	deadline := time.Now().Add(d)
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	resp, err := next.RoundTrip(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Carry the deadline over to the response body.
+	if b, ok := resp.Body.(BodyReader); ok {
+		b.SetReadDeadline(deadline)
+	}
+
+	return resp, nil
+}
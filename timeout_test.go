@@ -0,0 +1,45 @@
+package wire
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/erkl/heat"
+)
+
+func TestHostTimeout(t *testing.T) {
+	mw := HostTimeoutMiddleware(map[string]time.Duration{
+		"slow.example.com":     time.Hour,
+		"slow.example.com:444": time.Minute,
+		"none.example.com":     0,
+	}, time.Second)
+
+	tests := map[string]time.Duration{
+		"slow.example.com":     time.Hour,
+		"SLOW.example.com:443": time.Hour,
+		"slow.example.com:444": time.Minute,
+		"none.example.com":     0,
+		"other.example.com":    time.Second,
+	}
+
+	for remote, want := range tests {
+		next := RoundTripperFunc(func(ctx context.Context, req *heat.Request) (*heat.Response, error) {
+			d, ok := ctx.Deadline()
+			switch {
+			case want == 0 && ok:
+				t.Errorf("%s: round-trip has a deadline", remote)
+			case want != 0 && !ok:
+				t.Errorf("%s: round-trip has no deadline", remote)
+			case ok && (time.Until(d) > want || time.Until(d) < want-time.Second/2):
+				t.Errorf("%s: round-trip has a deadline %v away, want %v", remote, time.Until(d), want)
+			}
+			return &heat.Response{Status: 204}, nil
+		})
+
+		req := &heat.Request{Method: "GET", Scheme: "https", Remote: remote, URI: "/"}
+		if _, err := mw(context.Background(), req, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
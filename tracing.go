@@ -0,0 +1,161 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/erkl/heat"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type otelConfig struct {
+	propagator propagation.TextMapPropagator
+	spanName   func(req *heat.Request) string
+}
+
+// An OTelOption configures OTelMiddleware.
+type OTelOption func(*otelConfig)
+
+// WithPropagator sets the propagator used to inject trace context into
+// outgoing requests. The default is propagation.TraceContext (W3C Trace
+// Context).
+func WithPropagator(p propagation.TextMapPropagator) OTelOption {
+	return func(cfg *otelConfig) { cfg.propagator = p }
+}
+
+// WithSpanName sets the function used to name spans. By default, spans are
+// named "HTTP <method>".
+func WithSpanName(fn func(req *heat.Request) string) OTelOption {
+	return func(cfg *otelConfig) { cfg.spanName = fn }
+}
+
+// OTelMiddleware returns a Middleware which wraps each round-trip in an
+// OpenTelemetry client span, and propagates the trace context to the server
+// using request header fields.
+//
+// When the response has a body, the span isn't ended until the body has been
+// read in its entirety or closed.
+func OTelMiddleware(tracer trace.Tracer, opts ...OTelOption) Middleware {
+	cfg := otelConfig{
+		propagator: propagation.TraceContext{},
+		spanName: func(req *heat.Request) string {
+			return "HTTP " + req.Method
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		ctx, span := tracer.Start(ctx, cfg.spanName(req), trace.WithSpanKind(trace.SpanKindClient))
+
+		span.SetAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.url", req.Scheme+"://"+req.Remote+req.URI),
+			attribute.String("net.peer.name", req.Remote),
+		)
+
+		cfg.propagator.Inject(ctx, fieldsCarrier{&req.Fields})
+
+		resp, err := next.RoundTrip(ctx, req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			return nil, err
+		}
+
+		span.SetAttributes(attribute.Int("http.status_code", resp.Status))
+		if resp.Status >= 400 {
+			span.SetStatus(codes.Error, "")
+		}
+
+		if resp.Body == nil {
+			span.End()
+		} else {
+			resp.Body = &spanBody{r: resp.Body, span: span}
+		}
+
+		return resp, nil
+	}
+}
+
+// fieldsCarrier adapts heat.Fields to the propagation.TextMapCarrier
+// interface.
+type fieldsCarrier struct {
+	f *heat.Fields
+}
+
+func (c fieldsCarrier) Get(key string) string {
+	v, _ := c.f.Get(key)
+	return v
+}
+
+func (c fieldsCarrier) Set(key, value string) {
+	c.f.Set(key, value)
+}
+
+func (c fieldsCarrier) Keys() []string {
+	keys := make([]string, len(*c.f))
+	for i, f := range *c.f {
+		keys[i] = f.Name
+	}
+	return keys
+}
+
+// Compile-time type check.
+var _ BodyReader = new(spanBody)
+
+type spanBody struct {
+	r    io.ReadCloser
+	span trace.Span
+}
+
+func (b *spanBody) Read(buf []byte) (int, error) {
+	n, err := b.r.Read(buf)
+	if err == io.EOF {
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanBody) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeBodyTo(w, b.r)
+	if err == nil {
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanBody) SetReadDeadline(t time.Time) error {
+	if br, ok := b.r.(BodyReader); ok {
+		return br.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (b *spanBody) SetReadTimeout(d time.Duration) error {
+	return b.SetReadDeadline(deadline(d))
+}
+
+func (b *spanBody) Peek(n int) ([]byte, error) {
+	return peekBody(b.r, n)
+}
+
+func (b *spanBody) Close() error {
+	err := b.r.Close()
+	b.end()
+	return err
+}
+
+func (b *spanBody) end() {
+	if b.span != nil {
+		b.span.End()
+		b.span = nil
+	}
+}
@@ -1,8 +1,11 @@
 package wire
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,35 +14,219 @@ import (
 )
 
 var ErrUnsupportedScheme = errors.New("unsupported scheme in request")
-var ErrNilCancel = errors.New("round-trip cancelled with nil error")
+var ErrResponseHeaderTimeout = errors.New("timed out waiting for response header")
+var ErrHTTP2NotNegotiated = errors.New("server did not negotiate HTTP/2 (h2) via ALPN")
+var ErrHTTP2Unsupported = errors.New("HTTP/2 is not supported yet")
+var ErrUnsizedHTTP10Body = errors.New("HTTP/1.0 request body must have a Content-Length")
+
+// DefaultMaxIdleConnsPerHost is the default value of Transport's
+// MaxIdleConnsPerHost field.
+const DefaultMaxIdleConnsPerHost = 2
+
+// DefaultExpectContinueTimeout is the default value of Transport's
+// ExpectContinueTimeout field.
+const DefaultExpectContinueTimeout = 1 * time.Second
+
+// DefaultKeepAliveCheckInterval is the default value of Transport's
+// KeepAliveCheckInterval field.
+const DefaultKeepAliveCheckInterval = 250 * time.Millisecond
 
 type Transport struct {
 	// Dial specifies the function used to establish plain TCP connections
-	// with remote hosts.
+	// with remote hosts. If nil, a built-in dialer is used.
 	Dial func(addr string) (net.Conn, error)
 
 	// DialTLS specifies the function used to establish TLS connections with
-	// remote hosts.
+	// remote hosts. If nil, a TLS handshake (configured by TLSClientConfig)
+	// is performed over a connection established with Dial.
 	DialTLS func(addr string) (net.Conn, error)
 
+	// DNSCacheTTL, if positive, enables an in-process DNS cache for the
+	// built-in dialer (used when Dial is nil), holding on to resolved
+	// addresses for the specified duration. Expired entries are removed
+	// as new ones are added.
+	DNSCacheTTL time.Duration
+
+	// PreferNetwork restricts connections to a single address family, and
+	// must be "tcp4", "tcp6" or empty (meaning either). When Dial is set,
+	// host names are resolved before calling it, and only addresses of the
+	// preferred family are dialed.
+	PreferNetwork string
+
+	// LocalAddr is the local address used by the built-in dialer (see
+	// net.Dialer). If nil, one is picked automatically. LocalAddr has no
+	// effect when Dial is set; use a net.Dialer with its LocalAddr field
+	// set (or NewDialer) instead.
+	LocalAddr net.Addr
+
+	// DisableTCPNoDelay, if true, leaves Nagle's algorithm enabled on TCP
+	// connections. By default it's disabled (by setting TCP_NODELAY), as
+	// it adds latency to request-response workloads.
+	DisableTCPNoDelay bool
+
+	// DialTimeout limits how long establishing a connection with Dial or
+	// DialTLS may take. Dial attempts which time out fail with
+	// ErrDialTimeout. If zero, there is no timeout.
+	DialTimeout time.Duration
+
+	// DisableKeepAlives, if true, makes every request use a new connection,
+	// which is closed once the round-trip is complete. Requests are sent
+	// with a "Connection: close" header field.
+	DisableKeepAlives bool
+
 	// KeepAliveTimeout specifies how long keep-alive connections should be
 	// allowed to sit idle before being automatically terminated.
 	KeepAliveTimeout time.Duration
 
+	// KeepAliveCheckInterval specifies how often idle connections are checked
+	// against KeepAliveTimeout. If zero, DefaultKeepAliveCheckInterval is
+	// used.
+	KeepAliveCheckInterval time.Duration
+
+	// MaxIdleConnsPerHost limits the number of idle keep-alive connections
+	// kept around for each host. When the limit is exceeded, the connection
+	// which has been idle the longest is closed. If zero,
+	// DefaultMaxIdleConnsPerHost is used.
+	MaxIdleConnsPerHost int
+
+	// MaxIdleConns limits the total number of idle keep-alive connections
+	// across all hosts. When the limit is reached, the connection which has
+	// been idle the longest is closed to make room for a new one. If zero,
+	// there is no limit.
+	MaxIdleConns int
+
+	// MaxConnsPerHost limits the total number of connections, idle or in
+	// use, to each host. Round-trips which would exceed the limit block
+	// until a connection is either returned to the idle pool or closed, or
+	// until their context is done. If zero, there is no limit.
+	MaxConnsPerHost int
+
+	// ProxyURL, if not empty, is the URL of an HTTP proxy through which all
+	// requests are sent. HTTPS requests are tunnelled through the proxy
+	// using the CONNECT method, in which case DialTLS is not used.
+	ProxyURL string
+
+	// TLSClientConfig specifies the TLS configuration used when DialTLS is
+	// nil, and for connections tunnelled through a proxy. If nil, the
+	// default configuration is used.
+	TLSClientConfig *tls.Config
+
+	// TLSHandshakeTimeout limits how long TLS handshakes performed by the
+	// Transport itself (i.e. when DialTLS is nil, or when tunnelling through
+	// a proxy) may take. If zero, there is no timeout.
+	TLSHandshakeTimeout time.Duration
+
+	// ForceAttemptHTTP2, if true, requires HTTPS connections to negotiate
+	// HTTP/2 using ALPN, rather than falling back to HTTP/1.1. If the
+	// server doesn't agree to HTTP/2, the round-trip fails with
+	// ErrHTTP2NotNegotiated. As HTTP/2 itself isn't supported yet, it fails
+	// with ErrHTTP2Unsupported if the server does.
+	ForceAttemptHTTP2 bool
+
+	// DisableExpect100Continue makes the Transport ignore "Expect:
+	// 100-continue" request headers, sending request bodies immediately.
+	DisableExpect100Continue bool
+
+	// WriteTimeout limits how long writing the request header, and the
+	// request body, may take. Exceeding it fails the round-trip and closes
+	// the connection. If zero, there is no timeout.
+	WriteTimeout time.Duration
+
+	// ResponseHeaderTimeout limits how long to wait for the server's
+	// response header, counting from when the request header has been
+	// written. Exceeding it fails the round-trip with
+	// ErrResponseHeaderTimeout. If zero, there is no timeout.
+	ResponseHeaderTimeout time.Duration
+
+	// MaxDrainBytes is the maximum number of unread bytes which will be
+	// read and discarded when a response body is closed early, allowing
+	// the connection to be reused. Draining is abandoned (and the
+	// connection closed) if the bytes don't arrive within 100ms. If zero,
+	// bodies aren't drained.
+	MaxDrainBytes int64
+
+	// ReadBufferSize and WriteBufferSize specify the sizes of each
+	// connection's read and write buffers. If zero, 8 KB is used.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// ExpectContinueTimeout specifies how long to wait for a "100 Continue"
+	// response before sending the request body anyway, for requests with an
+	// "Expect: 100-continue" header. If zero,
+	// DefaultExpectContinueTimeout is used.
+	ExpectContinueTimeout time.Duration
+
+	// OnDialed, if not nil, is called each time the Transport has attempted
+	// to establish a new connection to addr (whether directly, through a
+	// proxy, or using a custom scheme's dial function), with the time the
+	// attempt took and its error, if any. It may be called concurrently.
+	OnDialed func(addr string, tls bool, d time.Duration, err error)
+
+	// OnConnReuse, if not nil, is called each time an idle keep-alive
+	// connection is taken from the pool to issue a request to addr, instead
+	// of establishing a new one. It may be called concurrently.
+	OnConnReuse func(addr string, tls bool)
+
+	// OnConnClose, if not nil, is called each time a connection to addr
+	// (or to a proxy, for plain HTTP requests sent through one) is closed,
+	// with one of the following reasons:
+	//
+	//	"idle_timeout"  idle for longer than KeepAliveTimeout
+	//	"pool_full"     evicted to respect MaxIdleConns or MaxIdleConnsPerHost
+	//	"server_close"  closed by the server while idle
+	//	"user_close"    closed by CloseIdleConnections
+	//	"not_reusable"  not kept alive after a round-trip (for example because
+	//	                of a "Connection: close" header field)
+	//	"error"         a round-trip failed or was cancelled
+	//
+	// It may be called concurrently, and with the Transport's internal locks
+	// held, so it must not call back into the Transport.
+	OnConnClose func(addr string, tls bool, reason string)
+
 	// Mutex protecting internal fields.
 	mu sync.Mutex
 
-	// Idle TCP and TLS connections. Keyed by hostname and stored in simple
+	// Idle connections, keyed by scheme and address and stored in simple
 	// singly-linked lists, the most recently used connection first.
-	idleTCP map[string]*conn
-	idleTLS map[string]*conn
+	idleConns map[poolKey]*conn
+
+	// Total number of connections in idleConns.
+	idle int
+
+	// Non-nil while the goroutine responsible for reaping old idle
+	// connections is running. Closing the channel halts the goroutine.
+	cleaning chan struct{}
+
+	// Mutex protecting the fields used to enforce MaxConnsPerHost. Kept
+	// separate from mu because connections are sometimes closed while mu
+	// is held.
+	hostMu sync.Mutex
 
-	// True if the goroutine responsible for reaping old idle connections
-	// is currently running.
-	cleaning bool
+	// Number of open connections per host, and channels used to wake up
+	// goroutines waiting for a connection to a particular host.
+	hostConns map[poolKey]int
+	hostWait  map[poolKey]chan struct{}
+
+	// Custom schemes added with RegisterScheme.
+	schemes map[string]customScheme
+
+	// DNS cache used by the built-in dialer, its mutex, and when expired
+	// entries were last removed from it.
+	dnsMu     sync.Mutex
+	dnsCache  map[string]dnsEntry
+	dnsPruned time.Time
 }
 
-func (t *Transport) RoundTrip(req *heat.Request, cancel <-chan error) (*heat.Response, error) {
+// RoundTrip issues an HTTP request and returns its response. If ctx is done
+// before the response header has been read, the round-trip is aborted and
+// ctx.Err() is returned.
+//
+// Requests with a body but neither a Content-Length nor a Transfer-Encoding
+// header field are sent using chunked encoding, with a "Transfer-Encoding:
+// chunked" field added to the header on the wire (req itself is left as is).
+// As HTTP/1.0 doesn't support chunked encoding, such HTTP/1.0 requests fail
+// with ErrUnsizedHTTP10Body.
+func (t *Transport) RoundTrip(ctx context.Context, req *heat.Request) (*heat.Response, error) {
 	if req.Body != nil {
 		defer req.Body.Close()
 	}
@@ -50,14 +237,22 @@ func (t *Transport) RoundTrip(req *heat.Request, cancel <-chan error) (*heat.Res
 		return nil, err
 	}
 
+	// Send bodies of unknown length using chunked encoding.
+	if unsizedBody(req, wsize) {
+		if req.Major == 1 && req.Minor == 0 {
+			return nil, ErrUnsizedHTTP10Body
+		}
+		wsize = heat.Chunked
+	}
+
 	// Only make the round-trip cancellable (by doing the work in a separate
-	// goroutine) if we were actually provided a cancel channel.
-	if cancel != nil {
-		return t.roundTripCancel(req, wsize, cancel)
+	// goroutine) if the context can actually be cancelled.
+	if ctx.Done() != nil {
+		return t.roundTripCancel(ctx, req, wsize)
 	}
 
 	// Establish a connection.
-	c, err := t.dial(req.Scheme, req.Remote)
+	c, err := t.dial(ctx, req.Scheme, req.Remote)
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +260,7 @@ func (t *Transport) RoundTrip(req *heat.Request, cancel <-chan error) (*heat.Res
 	// Issue the request and read the response.
 	resp, err := roundTrip(c, req, wsize)
 	if err != nil {
-		c.Close()
+		c.close("error")
 		return nil, err
 	}
 
@@ -78,14 +273,19 @@ type baton struct {
 	e error
 }
 
-func (t *Transport) roundTripCancel(req *heat.Request, wsize heat.BodySize, cancel <-chan error) (*heat.Response, error) {
+func (t *Transport) roundTripCancel(ctx context.Context, req *heat.Request, wsize heat.BodySize) (*heat.Response, error) {
+	// Don't bother dialing if the context is already done.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var ch = make(chan baton, 1)
 	var syn uint32
 	var c *conn
 
 	// Establish a connection.
 	go func() {
-		c, err := t.dial(req.Scheme, req.Remote)
+		c, err := t.dial(ctx, req.Scheme, req.Remote)
 		if atomic.CompareAndSwapUint32(&syn, 0, 1) {
 			ch <- baton{c: c, e: err}
 		} else if err == nil {
@@ -95,7 +295,7 @@ func (t *Transport) roundTripCancel(req *heat.Request, wsize heat.BodySize, canc
 
 	// Wait for the connection to be established.
 	select {
-	case err := <-cancel:
+	case <-ctx.Done():
 		// If the dial has already completed, recycle the connection.
 		if !atomic.CompareAndSwapUint32(&syn, 0, 1) {
 			if b := <-ch; b.c != nil {
@@ -103,74 +303,119 @@ func (t *Transport) roundTripCancel(req *heat.Request, wsize heat.BodySize, canc
 			}
 		}
 
-		// We can't return nil errors.
-		if err == nil {
-			return nil, ErrNilCancel
-		} else {
-			return nil, err
-		}
+		return nil, ctx.Err()
 
 	case b := <-ch:
 		if b.e != nil {
 			return nil, b.e
 		}
 
+		// Hold on to the connection, so it can be closed if the context
+		// is done before the response arrives.
+		c = b.c
+
 		// Write the request and read the response using a separate
 		// goroutine, as to not block this one.
 		go func() {
-			resp, err := roundTrip(b.c, req, wsize)
+			resp, err := roundTrip(c, req, wsize)
 			ch <- baton{r: resp, e: err}
 		}()
 	}
 
 	// Wait for the response to come back.
 	select {
-	case err := <-cancel:
-		c.Close()
-
-		// We can't return nil errors.
-		if err == nil {
-			return nil, ErrNilCancel
-		} else {
-			return nil, err
-		}
+	case <-ctx.Done():
+		// Closing the underlying connection unblocks the round-trip
+		// goroutine, but c (and its buffers in particular) can't be
+		// released until that goroutine is done with it.
+		c.raw.Close()
+		go func() {
+			if b := <-ch; b.r != nil && b.r.Body != nil {
+				b.r.Body.Close()
+			}
+			c.close("error")
+		}()
+		return nil, ctx.Err()
 
 	case b := <-ch:
-		return b.r, b.e
+		if b.e != nil {
+			c.close("error")
+			return nil, b.e
+		}
+		return b.r, nil
 	}
 }
 
 func roundTrip(c *conn, req *heat.Request, wsize heat.BodySize) (*heat.Response, error) {
-	// TODO: Add support for Expect: 100-continue.
-
 	// Write the request header.
-	if err := heat.WriteRequestHeader(c, req); err != nil {
+	c.setWriteTimeout()
+	if err := writeRequestHeader(c, req, wsize); err != nil {
 		return nil, err
 	}
 	if err := c.Flush(); err != nil {
 		return nil, err
 	}
+	if wsize == 0 {
+		c.clearWriteTimeout()
+	}
 
 	// Did the user explicitly disable keep-alive for this request?
-	reuse := !heat.Closing(req.Major, req.Minor, req.Fields)
+	reuse := !c.t.DisableKeepAlives && !heat.Closing(req.Major, req.Minor, req.Fields)
 
-	// Transmit the request body.
-	if wsize != 0 {
-		go func(reuse bool) {
-			err := heat.WriteBody(c, req.Body, wsize)
-			if err == nil {
-				err = c.Flush()
-			}
-			c.maybeClose(err == nil && reuse)
-		}(reuse)
-	} else {
-		c.maybeClose(reuse)
+	// If the request carries an "Expect: 100-continue" header, hold off on
+	// sending the body until the server tells us to go ahead.
+	var resp *heat.Response
+	var err error
+
+	if wsize != 0 && !c.t.DisableExpect100Continue && expectsContinue(req) {
+		resp, err = awaitContinue(c, c.t.expectContinueTimeout())
+		if err != nil {
+			return nil, err
+		}
+
+		// If the server responded without asking for the body, we can't
+		// reuse the connection (as the server may still expect to receive
+		// the body), so don't bother sending it.
+		if resp != nil {
+			c.maybeClose(false)
+		}
 	}
 
-	// Read the response.
-	resp, err := heat.ReadResponseHeader(c)
-	if err != nil {
-		return nil, err
+	// Transmit the request body.
+	if resp == nil {
+		var werr = make(chan error, 1)
+
+		if wsize != 0 {
+			go func(reuse bool) {
+				c.setWriteTimeout()
+				err := heat.WriteBody(c, req.Body, wsize)
+				if err == nil {
+					err = c.Flush()
+				}
+				c.clearWriteTimeout()
+
+				// A server which isn't reading the body is unlikely to
+				// send a response either, so don't leave the reading
+				// end waiting for one after a write timeout.
+				if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+					werr <- err
+					c.raw.Close()
+				}
+
+				c.maybeClose(err == nil && reuse)
+			}(reuse)
+		} else {
+			c.maybeClose(reuse)
+		}
+
+		// Read the response.
+		if resp, err = readResponseHeader(c); err != nil {
+			select {
+			case err = <-werr:
+			default:
+			}
+			return nil, err
+		}
 	}
 
 	rsize, err := heat.ResponseBodySize(resp, req.Method)
@@ -196,41 +441,352 @@ func roundTrip(c *conn, req *heat.Request, wsize heat.BodySize) (*heat.Response,
 	return resp, nil
 }
 
-func (t *Transport) dial(scheme, addr string) (*conn, error) {
+// readResponseHeader reads a response header from c, subject to the owning
+// Transport's ResponseHeaderTimeout.
+func readResponseHeader(c *conn) (*heat.Response, error) {
+	timeout := c.t.ResponseHeaderTimeout
+	if timeout <= 0 {
+		return heat.ReadResponseHeader(c)
+	}
+
+	c.raw.SetReadDeadline(time.Now().Add(timeout))
+	resp, err := heat.ReadResponseHeader(c)
+	c.raw.SetReadDeadline(time.Time{})
+
+	if err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			err = ErrResponseHeaderTimeout
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// A poolKey identifies the connections which can be used interchangeably for
+// requests with a given scheme and remote address.
+type poolKey struct {
+	scheme string
+	addr   string
+
+	// Address of the proxy the connection goes through, if any. Plain
+	// HTTP connections to proxies are shared across remote hosts, so
+	// their addr is empty.
+	proxy string
+
+	// TLS configuration the connection was established with, if it was
+	// set by the request's context rather than the Transport.
+	config *tls.Config
+
+	// Tag set by the request's context (see ContextWithConnTag).
+	tag string
+}
+
+// host returns the address of the remote end of connections with key k.
+func (k poolKey) host() string {
+	if k.addr == "" {
+		return k.proxy
+	}
+	return k.addr
+}
+
+type customScheme struct {
+	port string
+	dial func(addr string) (net.Conn, error)
+}
+
+// RegisterScheme adds support for requests with the given scheme. Connections
+// for such requests are established using dial, with defaultPort used for
+// addresses which lack a port number, and are kept alive and reused the same
+// way as plain HTTP connections.
+//
+// Registering "http" or "https" has no effect.
+func (t *Transport) RegisterScheme(scheme, defaultPort string, dial func(addr string) (net.Conn, error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.schemes == nil {
+		t.schemes = make(map[string]customScheme)
+	}
+
+	t.schemes[scheme] = customScheme{defaultPort, dial}
+}
+
+// expectsContinue reports whether req has an "Expect: 100-continue" header.
+func expectsContinue(req *heat.Request) bool {
+	v, ok := req.Fields.Get("Expect")
+	return ok && strings.EqualFold(strings.TrimSpace(v), "100-continue")
+}
+
+// awaitContinue waits for a "100 Continue" interim response. If the server
+// responds with a final response instead, it is returned. If nothing has been
+// received before the timeout, the client should go ahead and send the body
+// anyway.
+func awaitContinue(c *conn, timeout time.Duration) (*heat.Response, error) {
+	c.raw.SetReadDeadline(time.Now().Add(timeout))
+	resp, err := heat.ReadResponseHeader(c)
+	c.raw.SetReadDeadline(time.Time{})
+
+	if err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if resp.Status == 100 {
+		return nil, nil
+	}
+
+	return resp, nil
+}
+
+// unsizedBody reports whether req has a body, but no header fields from
+// which its size can be determined.
+func unsizedBody(req *heat.Request, size heat.BodySize) bool {
+	return req.Body != nil && (size == heat.Unbounded || size == 0 && !req.Fields.Has("Content-Length"))
+}
+
+// writeRequestHeader writes the header of req, which will be followed by a
+// body of the given size, adjusting it as needed without modifying req.
+func writeRequestHeader(c *conn, req *heat.Request, size heat.BodySize) error {
+	// Upgrade requests (see Hijack) rely on their own Connection field.
+	closing := c.t.DisableKeepAlives && !req.Fields.Has("Upgrade") && !heat.Closing(req.Major, req.Minor, req.Fields)
+	chunked := size == heat.Chunked && !req.Fields.Has("Transfer-Encoding")
+	if c.proxy == nil && !closing && !chunked {
+		return heat.WriteRequestHeader(c, req)
+	}
+
+	// Serialize a copy, as the caller may be looking at req concurrently.
+	dup := *req
+	dup.Fields = append(heat.Fields(nil), req.Fields...)
+	if closing {
+		dup.Fields.Set("Connection", "close")
+	}
+	if chunked {
+		dup.Fields.Set("Transfer-Encoding", "chunked")
+	}
+
+	// Requests sent to a proxy must use the absolute URI form, and carry
+	// the proxy's credentials (if any).
+	if c.proxy != nil {
+		dup.URI = "http://" + req.Remote + req.URI
+		if c.proxy.auth != "" {
+			dup.Fields.Set("Proxy-Authorization", c.proxy.auth)
+		}
+	}
+
+	return heat.WriteRequestHeader(c, &dup)
+}
+
+func (t *Transport) dial(ctx context.Context, scheme, addr string) (*conn, error) {
 	var dial func(addr string) (net.Conn, error)
+	var secure, custom bool
+	var cfg *tls.Config
 
 	// Scheme-specific rules.
 	switch scheme {
 	case "http":
 		addr = defaultPort(addr, "80")
-		if c := t.takeIdle(t.idleTCP, addr); c != nil {
-			return c, nil
-		}
-		dial = t.Dial
+		dial = t.dialer()
 
 	case "https":
 		addr = defaultPort(addr, "443")
-		if c := t.takeIdle(t.idleTLS, addr); c != nil {
-			return c, nil
+		dial = withTimeout(t.DialTLS, t.DialTimeout)
+		secure = true
+
+		// A TLS configuration carried by the context (see MTLSMiddleware)
+		// takes precedence over both DialTLS and TLSClientConfig.
+		if cfg = tlsConfigFrom(ctx); cfg != nil || t.DialTLS == nil {
+			dial = func(addr string) (net.Conn, error) {
+				return t.dialTLSConfig(addr, cfg)
+			}
 		}
-		dial = t.DialTLS
 
 	default:
-		return nil, ErrUnsupportedScheme
+		t.mu.Lock()
+		s, ok := t.schemes[scheme]
+		t.mu.Unlock()
+
+		if !ok {
+			return nil, ErrUnsupportedScheme
+		}
+
+		addr = defaultPort(addr, s.port)
+		dial = withTimeout(s.dial, t.DialTimeout)
+		custom = true
+	}
+
+	// Connections are pooled by scheme and address, by the proxy used to
+	// reach them (if any), and by tag. The dial function is called with via.
+	var key = poolKey{scheme: scheme, addr: addr, config: cfg, tag: connTagFrom(ctx)}
+	var via = addr
+	var p *proxy
+
+	// Route the connection through a proxy, if one has been configured.
+	// Plain HTTP requests are sent to the proxy directly (so connections to
+	// the proxy can be shared across hosts), whereas HTTPS requests are
+	// tunnelled through it using the CONNECT method.
+	if t.ProxyURL != "" && !custom {
+		var err error
+		if p, err = parseProxy(t.ProxyURL); err != nil {
+			return nil, err
+		}
+
+		key.proxy = p.addr
+
+		if !secure {
+			key.addr = ""
+			via = p.addr
+			dial = t.dialer()
+		} else {
+			dial = func(string) (net.Conn, error) {
+				return t.dialTunnel(p, addr, cfg)
+			}
+		}
+	}
+
+	// Reuse an idle connection if there is one. If not, and we're limiting
+	// the number of connections per host, wait until we're either allowed to
+	// dial a new connection or another one is returned to the idle pool.
+	var counted bool
+
+	for {
+		var wait <-chan struct{}
+		if t.MaxConnsPerHost > 0 {
+			wait = t.hostWaiter(key)
+		}
+
+		if c := t.takeLiveIdle(key); c != nil {
+			if t.OnConnReuse != nil {
+				t.OnConnReuse(addr, secure)
+			}
+			return t.checkConn(ctx, c)
+		}
+
+		if wait == nil {
+			break
+		}
+		if t.acquireHost(key) {
+			counted = true
+			break
+		}
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
 	// Invoke the real dial function.
-	raw, err := dial(addr)
+	start := time.Now()
+	raw, err := dial(via)
+	if err == nil && secure && t.ForceAttemptHTTP2 {
+		if err = checkHTTP2(raw); err != nil {
+			raw.Close()
+		}
+	}
+	if t.OnDialed != nil {
+		t.OnDialed(addr, secure, time.Since(start), err)
+	}
 	if err != nil {
+		if counted {
+			t.releaseHost(key)
+		}
 		return nil, err
 	}
 
-	return newConn(raw, t, scheme == "https", addr), nil
+	c := newConn(raw, t, secure, key)
+	c.counted = counted
+
+	if p != nil && !secure {
+		c.proxy = p
+	}
+
+	return t.checkConn(ctx, c)
+}
+
+// checkHTTP2 verifies that HTTP/2 was negotiated (using ALPN) for the TLS
+// connection raw. As HTTP/2 isn't supported yet, it fails either way.
+func checkHTTP2(raw net.Conn) error {
+	tc, ok := raw.(interface {
+		ConnectionState() tls.ConnectionState
+	})
+	if !ok || tc.ConnectionState().NegotiatedProtocol != "h2" {
+		return ErrHTTP2NotNegotiated
+	}
+	return ErrHTTP2Unsupported
+}
+
+// hostWaiter returns a channel which will be closed the next time a
+// connection to key is closed or returned to the idle pool.
+func (t *Transport) hostWaiter(key poolKey) <-chan struct{} {
+	t.hostMu.Lock()
+	defer t.hostMu.Unlock()
+
+	if t.hostWait == nil {
+		t.hostWait = make(map[poolKey]chan struct{})
+	}
+
+	ch := t.hostWait[key]
+	if ch == nil {
+		ch = make(chan struct{})
+		t.hostWait[key] = ch
+	}
+
+	return ch
+}
+
+// acquireHost reserves a slot for a new connection to key, returning false
+// if MaxConnsPerHost connections are already open.
+func (t *Transport) acquireHost(key poolKey) bool {
+	t.hostMu.Lock()
+	defer t.hostMu.Unlock()
+
+	if t.hostConns[key] >= t.MaxConnsPerHost {
+		return false
+	}
+
+	if t.hostConns == nil {
+		t.hostConns = make(map[poolKey]int)
+	}
+
+	t.hostConns[key]++
+	return true
+}
+
+// releaseHost frees up a slot previously reserved by acquireHost.
+func (t *Transport) releaseHost(key poolKey) {
+	t.hostMu.Lock()
+	defer t.hostMu.Unlock()
+
+	if t.hostConns[key] > 1 {
+		t.hostConns[key]--
+	} else {
+		delete(t.hostConns, key)
+	}
+
+	t.wakeHost(key)
+}
+
+// wakeHost unblocks all goroutines waiting for a connection to key. The
+// caller must hold t.hostMu.
+func (t *Transport) wakeHost(key poolKey) {
+	if ch := t.hostWait[key]; ch != nil {
+		close(ch)
+		delete(t.hostWait, key)
+	}
 }
 
 func defaultPort(addr, port string) string {
 	if !hasPort(addr) {
-		addr = net.JoinHostPort(addr, "80")
+		// Strip the brackets from bare IPv6 literals, or JoinHostPort
+		// will add a second pair.
+		if n := len(addr); n > 1 && addr[0] == '[' && addr[n-1] == ']' {
+			addr = addr[1 : n-1]
+		}
+		addr = net.JoinHostPort(addr, port)
 	}
 	return addr
 }
@@ -246,7 +802,7 @@ func hasPort(addr string) bool {
 	for i, c := range addr {
 		if c == ':' {
 			colons++
-			rbrack = addr[i-1] == ']'
+			rbrack = i > 0 && addr[i-1] == ']'
 		}
 	}
 
@@ -260,92 +816,257 @@ func hasPort(addr string) bool {
 	}
 }
 
-func (t *Transport) takeIdle(m map[string]*conn, addr string) *conn {
+// takeLiveIdle is like takeIdle, but skips (and closes) idle connections
+// which have been closed by the server.
+func (t *Transport) takeLiveIdle(key poolKey) *conn {
+	for {
+		c := t.takeIdle(key)
+		if c == nil || peekIdle(c) {
+			return c
+		}
+		c.close("server_close")
+	}
+}
+
+// peekIdle checks whether an idle connection is still usable, using a
+// non-blocking read. A timeout means nothing has been received and the
+// connection is alive; anything else (io.EOF in particular, or unsolicited
+// data) means it isn't.
+func peekIdle(c *conn) bool {
+	var one [1]byte
+
+	c.raw.SetReadDeadline(time.Now())
+	_, err := c.raw.Read(one[:])
+	c.raw.SetReadDeadline(time.Time{})
+
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+func (t *Transport) takeIdle(key poolKey) *conn {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	c := m[addr]
+	c := t.idleConns[key]
 	if c == nil {
 		return nil
 	}
 
 	// Unlink the connection.
 	if c.next != nil {
-		m[addr] = c.next
+		t.idleConns[key] = c.next
 		c.next = nil
 	} else {
-		delete(m, addr)
+		delete(t.idleConns, key)
 	}
 
+	t.idle--
 	return c
 }
 
 func (t *Transport) putIdle(c *conn) {
+	if t.DisableKeepAlives {
+		c.close("not_reusable")
+		return
+	}
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	// Update the idle timestamp.
 	c.idleSince = time.Now()
 
-	// Put the connection in the relevant map.
-	if !c.tls {
-		put(&t.idleTCP, c)
-	} else {
-		put(&t.idleTLS, c)
+	// Make room for the connection if we're at the global limit.
+	for t.MaxIdleConns > 0 && t.idle >= t.MaxIdleConns {
+		if !t.evictOldest() {
+			break
+		}
+	}
+
+	// Put the connection in the pool.
+	t.idle += 1 - put(&t.idleConns, c, t.maxIdleConnsPerHost())
+
+	// Let any goroutines waiting for a connection to this host know that
+	// one has become available.
+	if t.MaxConnsPerHost > 0 {
+		t.hostMu.Lock()
+		t.wakeHost(c.key)
+		t.hostMu.Unlock()
 	}
 
 	// Start the garbage collection goroutine.
-	if !t.cleaning && t.KeepAliveTimeout > 0 {
-		t.cleaning = true
-		go t.clean()
+	if t.cleaning == nil && t.KeepAliveTimeout > 0 {
+		t.cleaning = make(chan struct{})
+		go t.clean(t.cleaning)
+	}
+}
+
+func (t *Transport) expectContinueTimeout() time.Duration {
+	if t.ExpectContinueTimeout > 0 {
+		return t.ExpectContinueTimeout
+	}
+	return DefaultExpectContinueTimeout
+}
+
+func (t *Transport) bufferSizes() (int, int) {
+	rsize, wsize := t.ReadBufferSize, t.WriteBufferSize
+	if rsize <= 0 {
+		rsize = bufferSize
+	}
+	if wsize <= 0 {
+		wsize = bufferSize
+	}
+	return rsize, wsize
+}
+
+func (t *Transport) maxIdleConnsPerHost() int {
+	if t.MaxIdleConnsPerHost != 0 {
+		return t.MaxIdleConnsPerHost
 	}
+	return DefaultMaxIdleConnsPerHost
 }
 
-func put(m *map[string]*conn, c *conn) {
+// put inserts c at the front of its host's list of idle connections, then
+// trims the list to at most max entries. It returns the number of connections
+// closed in the process.
+func put(m *map[poolKey]*conn, c *conn, max int) int {
 	if *m == nil {
-		*m = make(map[string]*conn)
+		*m = make(map[poolKey]*conn)
+	}
+
+	c.next = (*m)[c.key]
+	(*m)[c.key] = c
+
+	// Fast forward to the last connection we're allowed to keep.
+	for i := 1; i < max && c != nil; i++ {
+		c = c.next
 	}
 
-	c.next = (*m)[c.addr]
-	(*m)[c.addr] = c
+	// Close the (least recently used) connections beyond that point.
+	var n int
+	if c != nil {
+		for x := c.next; x != nil; x = x.next {
+			x.close("pool_full")
+			n++
+		}
+		c.next = nil
+	}
+
+	return n
 }
 
-func (t *Transport) clean() {
-	ticker := time.NewTicker(250 * time.Millisecond)
+// evictOldest closes the least recently used idle connection, regardless of
+// which host it belongs to. It returns false if there were no idle
+// connections to evict.
+func (t *Transport) evictOldest() bool {
+	var prev, oldest *conn
+
+	// The oldest connection for each host sits at the end of its list.
+	for _, c := range t.idleConns {
+		var p *conn
+		for c.next != nil {
+			p, c = c, c.next
+		}
+
+		if oldest == nil || c.idleSince.Before(oldest.idleSince) {
+			prev, oldest = p, c
+		}
+	}
+
+	if oldest == nil {
+		return false
+	}
+
+	// Unlink the connection.
+	if prev != nil {
+		prev.next = nil
+	} else {
+		delete(t.idleConns, oldest.key)
+	}
+
+	oldest.close("pool_full")
+	t.idle--
+
+	return true
+}
+
+// CloseIdleConnections closes all idle keep-alive connections. Connections
+// currently in use are not affected.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, c := range t.idleConns {
+		for c != nil {
+			c.close("user_close")
+			c = c.next
+		}
+	}
+
+	t.idleConns = nil
+	t.idle = 0
+
+	// Halt the cleaning goroutine.
+	if t.cleaning != nil {
+		close(t.cleaning)
+		t.cleaning = nil
+	}
+}
+
+func (t *Transport) clean(stop chan struct{}) {
+	interval := t.KeepAliveCheckInterval
+	if interval <= 0 {
+		interval = DefaultKeepAliveCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	// Continually loop and close connections that have been idle
 	// for at least KeepAliveTimeout.
-	for _ = range ticker.C {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
 		t.mu.Lock()
 
+		// Bail if we were halted while waiting for the lock.
+		if t.cleaning != stop {
+			t.mu.Unlock()
+			return
+		}
+
 		cutoff := time.Now().Add(-t.KeepAliveTimeout)
-		drop(t.idleTCP, cutoff)
-		drop(t.idleTLS, cutoff)
+		t.idle -= drop(t.idleConns, cutoff)
 
 		// When all idle connections have been closed, halt.
-		if len(t.idleTCP) == 0 && len(t.idleTLS) == 0 {
-			t.idleTCP = nil
-			t.idleTLS = nil
-			t.cleaning = false
+		if len(t.idleConns) == 0 {
+			t.idleConns = nil
+			t.cleaning = nil
 
 			t.mu.Unlock()
-			break
+			return
 		}
 
 		t.mu.Unlock()
 	}
 }
 
-func drop(m map[string]*conn, cutoff time.Time) {
+func drop(m map[poolKey]*conn, cutoff time.Time) int {
+	var n int
+
 	for h, conn := range m {
 		// Because connections are ordered by their last-use time in descending
 		// order, we can quickly discard the whole chain if the first connection
 		// has sat idle for too long.
 		if conn.idleSince.Before(cutoff) {
 			for conn != nil {
-				conn.Close()
+				conn.close("idle_timeout")
 				conn = conn.next
+				n++
 			}
 
 			delete(m, h)
@@ -365,10 +1086,13 @@ func drop(m map[string]*conn, cutoff time.Time) {
 		// Close all connections after last in the linked list, then reset
 		// last.next to let them be garbage collected.
 		for conn != nil {
-			conn.Close()
+			conn.close("idle_timeout")
 			conn = conn.next
+			n++
 		}
 
 		last.next = nil
 	}
+
+	return n
 }
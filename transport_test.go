@@ -0,0 +1,437 @@
+package wire
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/erkl/heat"
+	"github.com/erkl/xo"
+)
+
+// testServer accepts connections on a local listener until the test ends,
+// passing each one to handle. It returns the listener's address.
+func testServer(t *testing.T, handle func(c net.Conn)) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// serveHTTP reads requests from c and responds to each with the response
+// returned by fn, until c is closed.
+func serveHTTP(c net.Conn, fn func(req *heat.Request, body []byte) *heat.Response) {
+	r := xo.NewReader(c, make([]byte, bufferSize))
+	w := xo.NewWriter(c, make([]byte, bufferSize))
+
+	for {
+		req, err := heat.ReadRequestHeader(r)
+		if err != nil {
+			return
+		}
+
+		size, err := heat.RequestBodySize(req)
+		if err != nil {
+			return
+		}
+
+		var body []byte
+		if size != 0 {
+			br, _ := heat.OpenBody(r, size)
+			if body, err = ioutil.ReadAll(br); err != nil {
+				return
+			}
+		}
+
+		resp := fn(req, body)
+		if err := heat.WriteResponseHeader(w, resp); err != nil {
+			return
+		}
+		if resp.Body != nil {
+			n, _ := resp.Fields.Get("Content-Length")
+			size, _ := strconv.Atoi(n)
+			if err := heat.WriteBody(w, resp.Body, heat.BodySize(size)); err != nil {
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// textResponse returns a 200 response with the given body.
+func textResponse(body string) *heat.Response {
+	resp := &heat.Response{Major: 1, Minor: 1, Status: 200, Reason: "OK"}
+	resp.Fields.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Body = ioutil.NopCloser(strings.NewReader(body))
+	return resp
+}
+
+// testRequest returns a GET request for path on addr.
+func testRequest(addr, path string) *heat.Request {
+	req := &heat.Request{
+		Method: "GET",
+		Scheme: "http",
+		Remote: addr,
+		URI:    path,
+		Major:  1,
+		Minor:  1,
+	}
+	req.Fields.Set("Host", addr)
+	return req
+}
+
+func TestRoundTripCancelMidResponse(t *testing.T) {
+	closed := make(chan struct{})
+
+	addr := testServer(t, func(c net.Conn) {
+		r := xo.NewReader(c, make([]byte, bufferSize))
+		if _, err := heat.ReadRequestHeader(r); err != nil {
+			return
+		}
+
+		// Send part of the response header, then stall until the client
+		// gives up and closes the connection.
+		io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Le")
+		c.Read(make([]byte, 1))
+	})
+
+	tr := &Transport{
+		OnConnClose: func(addr string, tls bool, reason string) {
+			if reason == "error" {
+				close(closed)
+			}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := tr.RoundTrip(ctx, testRequest(addr, "/")); err != context.DeadlineExceeded {
+		t.Fatalf("RoundTrip returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("RoundTrip took %v to return after cancellation", d)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't closed after cancellation")
+	}
+}
+
+func TestDefaultPort(t *testing.T) {
+	tests := []struct {
+		addr, port, want string
+	}{
+		{"example.com", "80", "example.com:80"},
+		{"example.com", "443", "example.com:443"},
+		{"example.com:8080", "80", "example.com:8080"},
+		{"example.com:8443", "443", "example.com:8443"},
+		{"127.0.0.1", "443", "127.0.0.1:443"},
+		{"127.0.0.1:80", "443", "127.0.0.1:80"},
+		{"::1", "80", "[::1]:80"},
+		{"[::1]", "443", "[::1]:443"},
+		{"[::1]:8080", "80", "[::1]:8080"},
+		{"[fe80::1%en0]", "443", "[fe80::1%en0]:443"},
+		{"[fe80::1%en0]:8443", "443", "[fe80::1%en0]:8443"},
+	}
+
+	for _, tt := range tests {
+		if got := defaultPort(tt.addr, tt.port); got != tt.want {
+			t.Errorf("defaultPort(%q, %q) = %q, want %q", tt.addr, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestMaxConnsPerHostRecycle(t *testing.T) {
+	var accepted int32
+
+	addr := testServer(t, func(c net.Conn) {
+		atomic.AddInt32(&accepted, 1)
+		serveHTTP(c, func(req *heat.Request, body []byte) *heat.Response {
+			return textResponse("ok")
+		})
+	})
+
+	tr := &Transport{MaxConnsPerHost: 1}
+	ctx := context.Background()
+
+	// Hold on to the only connection allowed by not closing the body.
+	resp, err := tr.RoundTrip(ctx, testRequest(addr, "/first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := tr.RoundTrip(ctx, testRequest(addr, "/second"))
+		if err == nil {
+			err = resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("second RoundTrip didn't block (err = %v)", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Reading the body to the end recycles the connection, which should
+	// unblock the second round-trip.
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second RoundTrip wasn't unblocked by recycled connection")
+	}
+
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	closed := make(chan string, 1)
+
+	// The server never reads the request, so the client's writes will
+	// eventually block.
+	addr := testServer(t, func(c net.Conn) {
+		time.Sleep(2 * time.Second)
+	})
+
+	tr := &Transport{
+		WriteTimeout: 100 * time.Millisecond,
+		OnConnClose: func(addr string, tls bool, reason string) {
+			closed <- reason
+		},
+	}
+
+	const size = 64 << 20
+
+	req := testRequest(addr, "/upload")
+	req.Method = "POST"
+	req.Fields.Set("Content-Length", strconv.Itoa(size))
+	req.Body = ioutil.NopCloser(io.LimitReader(zeros{}, size))
+
+	_, err := tr.RoundTrip(context.Background(), req)
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("RoundTrip returned %v, want a timeout error", err)
+	}
+
+	select {
+	case reason := <-closed:
+		if reason != "error" {
+			t.Errorf("connection closed with reason %q, want %q", reason, "error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't closed after write timeout")
+	}
+}
+
+// zeros is an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	return len(buf), nil
+}
+
+// chunkyReader returns its chunks one Read call at a time.
+type chunkyReader struct {
+	chunks []string
+}
+
+func (r *chunkyReader) Read(buf []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(buf, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestChunkedRequestBody(t *testing.T) {
+	type received struct {
+		te   string
+		body string
+	}
+	ch := make(chan received, 1)
+
+	addr := testServer(t, func(c net.Conn) {
+		serveHTTP(c, func(req *heat.Request, body []byte) *heat.Response {
+			te, _ := req.Fields.Get("Transfer-Encoding")
+			ch <- received{te, string(body)}
+			return textResponse("ok")
+		})
+	})
+
+	req := testRequest(addr, "/upload")
+	req.Method = "POST"
+	req.Body = ioutil.NopCloser(&chunkyReader{
+		chunks: []string{"hello", ", ", "chunked ", "world"},
+	})
+
+	resp, err := new(Transport).RoundTrip(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	got := <-ch
+	if got.te != "chunked" {
+		t.Errorf("server saw Transfer-Encoding %q, want %q", got.te, "chunked")
+	}
+	if got.body != "hello, chunked world" {
+		t.Errorf("server received body %q", got.body)
+	}
+	if req.Fields.Has("Transfer-Encoding") {
+		t.Error("RoundTrip added Transfer-Encoding to the caller's request")
+	}
+}
+
+func TestChunkedRequestBodyHTTP10(t *testing.T) {
+	req := testRequest("127.0.0.1:1", "/upload")
+	req.Method = "POST"
+	req.Minor = 0
+	req.Body = ioutil.NopCloser(strings.NewReader("data"))
+
+	if _, err := new(Transport).RoundTrip(context.Background(), req); err != ErrUnsizedHTTP10Body {
+		t.Fatalf("RoundTrip returned %v, want %v", err, ErrUnsizedHTTP10Body)
+	}
+}
+
+func TestDrainStalledBody(t *testing.T) {
+	closed := make(chan string, 1)
+
+	addr := testServer(t, func(c net.Conn) {
+		r := xo.NewReader(c, make([]byte, bufferSize))
+		if _, err := heat.ReadRequestHeader(r); err != nil {
+			return
+		}
+
+		// Promise a body, but only send part of it.
+		io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\npartial")
+		c.Read(make([]byte, 1))
+	})
+
+	tr := &Transport{
+		MaxDrainBytes: 1 << 10,
+		OnConnClose: func(addr string, tls bool, reason string) {
+			closed <- reason
+		},
+	}
+
+	resp, err := tr.RoundTrip(context.Background(), testRequest(addr, "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp.Body.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Close blocked for %v", d)
+	}
+
+	select {
+	case reason := <-closed:
+		if reason != "not_reusable" {
+			t.Errorf("connection closed with reason %q, want %q", reason, "not_reusable")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't closed after abandoned drain")
+	}
+}
+
+func TestRoundTripCancelBeforeDial(t *testing.T) {
+	var dials int32
+
+	tr := &Transport{
+		Dial: func(addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return nil, io.EOF
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tr.RoundTrip(ctx, testRequest("example.com", "/")); err != context.Canceled {
+		t.Fatalf("RoundTrip returned %v, want %v", err, context.Canceled)
+	}
+	if n := atomic.LoadInt32(&dials); n != 0 {
+		t.Errorf("Dial was called %d times, want 0", n)
+	}
+}
+
+func TestRoundTripCancelDuringDial(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+
+	tr := &Transport{
+		Dial: func(addr string) (net.Conn, error) {
+			close(dialing)
+			<-release
+			return nil, io.EOF
+		},
+	}
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-dialing
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := tr.RoundTrip(ctx, testRequest("example.com", "/"))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("RoundTrip returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RoundTrip didn't return after cancellation during dial")
+	}
+}
@@ -0,0 +1,25 @@
+package wire
+
+import "net"
+
+// UnixSocketScheme is the scheme registered by Transport.RegisterUnixSocket.
+const UnixSocketScheme = "http+unix"
+
+// NewUnixSocketDialer returns a dial function which ignores the address it's
+// given, and always connects to the Unix domain socket at socketPath. It's
+// meant to be used with Transport.RegisterScheme (or RegisterUnixSocket).
+func NewUnixSocketDialer(socketPath string) func(addr string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		return net.Dial("unix", socketPath)
+	}
+}
+
+// RegisterUnixSocket makes requests with the "http+unix" scheme be sent over
+// the Unix domain socket at socketPath. The request's remote host is only
+// used for the Host header field:
+//
+//	t.RegisterUnixSocket("/var/run/docker.sock")
+//	req, _ := wire.NewRequest("GET", "http+unix://docker/v1.41/info", nil)
+func (t *Transport) RegisterUnixSocket(socketPath string) {
+	t.RegisterScheme(UnixSocketScheme, "80", NewUnixSocketDialer(socketPath))
+}
@@ -0,0 +1,24 @@
+package wire
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidURL = errors.New("invalid request URL")
+
+// parseURL splits an absolute URL into the scheme, remote host and request
+// URI (path and query) used by heat.Request.
+func parseURL(rawurl string) (scheme, remote, uri string, err error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", "", "", ErrInvalidURL
+	}
+
+	return strings.ToLower(u.Scheme), u.Host, u.RequestURI(), nil
+}
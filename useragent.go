@@ -0,0 +1,21 @@
+package wire
+
+import (
+	"context"
+
+	"github.com/erkl/heat"
+)
+
+// DefaultUserAgent is a User-Agent string identifying this package.
+const DefaultUserAgent = "wire/1.0"
+
+// UserAgentMiddleware returns a Middleware which sets the User-Agent header
+// to ua on requests which don't already have one.
+func UserAgentMiddleware(ua string) Middleware {
+	return func(ctx context.Context, req *heat.Request, next RoundTripper) (*heat.Response, error) {
+		if !req.Fields.Has("User-Agent") {
+			req.Fields.Set("User-Agent", ua)
+		}
+		return next.RoundTrip(ctx, req)
+	}
+}